@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/testnet"
+)
+
+// createRouters adds routers to the running testnet in parallel, printing progress and saving the state after every router that comes up
+func createRouters(ctx context.Context, specs []testnet.RouterSpec, parallel int) error {
+	_, err := tn.AddRouters(ctx, specs, parallel, func(done int, total int, spec testnet.RouterSpec, r state.Router, err error) {
+		if err != nil {
+			fmt.Printf("[%d/%d] failed to create %s router: %v\n", done, total, spec.Kind, err)
+			return
+		}
+		fmt.Printf("[%d/%d] created %s (%s)\n", done, total, r.Name, r.IP)
+		persistState()
+	})
+	return err
+}
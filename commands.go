@@ -0,0 +1,838 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/testnet"
+	"go-i2p-testnet/lib/topology"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DEFAULT_READY_TIMEOUT is how long wait-ready waits unless --timeout says otherwise
+const DEFAULT_READY_TIMEOUT = 5 * time.Minute
+
+// errNotRunning is returned by commands that need a running testnet
+var errNotRunning = errors.New("testnet isn't running")
+
+// usageError reports a malformed command line, the CLI exits with status 2 for it
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// command is a testnet operation shared by the interactive shell and the subcommand CLI
+type command struct {
+	run func(cli *client.Client, ctx context.Context, args []string) error
+	// modifies marks commands that change the testnet, so the state file has to be rewritten afterwards
+	modifies bool
+}
+
+var commands = map[string]command{
+	"start":         {run: cmdStart, modifies: true},
+	"stop":          {run: cmdStop, modifies: true},
+	"attach":        {run: cmdAttach, modifies: true},
+	"list":          {run: cmdList},
+	"status":        {run: cmdStatus},
+	"usage":         {run: cmdUsage},
+	"build":         {run: cmdBuild},
+	"rebuild":       {run: cmdRebuild},
+	"remove_images": {run: cmdRemoveImages},
+	"images":        {run: cmdImages},
+	"add":           {run: cmdAdd, modifies: true},
+	"remove":        {run: nodeCommand("remove"), modifies: true},
+	"restart":       {run: nodeCommand("restart")},
+	"stop-node":     {run: nodeCommand("stop-node")},
+	"start-node":    {run: nodeCommand("start-node")},
+	"pause":         {run: nodeCommand("pause")},
+	"unpause":       {run: nodeCommand("unpause")},
+	"wait-ready":    {run: cmdWaitReady},
+	"save_topology": {run: cmdSaveTopology},
+	"sync":          {run: cmdSync},
+	"sync_shared":   {run: cmdSyncShared},
+	"sync_netdb":    {run: cmdSyncNetDb},
+	"logs":          {run: cmdLogs},
+	"netem":         {run: cmdNetem, modifies: true},
+	"partition":     {run: cmdPartition, modifies: true},
+	"heal":          {run: cmdHeal, modifies: true},
+	"ports":         {run: cmdPorts},
+	// The sync commands used to only handle i2pd routers
+	"sync_i2pd_shared": {run: cmdSyncShared},
+	"sync_i2pd_netdb":  {run: cmdSyncNetDb},
+	"prune":            {run: cmdPrune},
+}
+
+// runCommand dispatches a tokenized command line to its command
+func runCommand(cli *client.Client, ctx context.Context, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return usageError{fmt.Sprintf("unknown command %q, type 'help' for a list of commands", args[0])}
+	}
+	log.WithField("command", args[0]).Debug("Processing command")
+	if err := cmd.run(cli, ctx, args[1:]); err != nil {
+		// Commands persist their partial progress themselves, so a failure must not overwrite the state file
+		return err
+	}
+	if cmd.modifies {
+		if err := saveState(); err != nil {
+			log.WithError(err).Error("Failed to save testnet state")
+			return fmt.Errorf("failed to save testnet state: %v", err)
+		}
+	}
+	return nil
+}
+
+// parseFlags parses flags that may be interleaved with positional arguments and returns the positional ones
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, usageError{err.Error()}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// natFlag is --behind-nat, which takes the kind of NAT as an optional value: --behind-nat, --behind-nat=symmetric
+// or, picked up from the positional arguments, --behind-nat symmetric
+type natFlag struct {
+	nat string
+	// bare is set when the flag was given without a value
+	bare bool
+}
+
+func (f *natFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.nat
+}
+
+func (f *natFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.nat, f.bare = topology.NAT_FULL_CONE, true
+		return nil
+	case "false":
+		f.nat, f.bare = "", false
+		return nil
+	}
+	if err := topology.ValidateNAT(value); err != nil {
+		return err
+	}
+	f.nat, f.bare = value, false
+	return nil
+}
+
+func (f *natFlag) IsBoolFlag() bool { return true }
+
+// takeValue moves a kind of NAT following a bare flag out of the positional arguments
+func (f *natFlag) takeValue(positional []string) []string {
+	if !f.bare {
+		return positional
+	}
+	for i, arg := range positional {
+		if arg == topology.NAT_FULL_CONE || arg == topology.NAT_SYMMETRIC {
+			f.nat = arg
+			return append(positional[:i:i], positional[i+1:]...)
+		}
+	}
+	return positional
+}
+
+func cmdStart(cli *client.Client, ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("start", flag.ContinueOnError)
+	topologyPath := fs.String("topology", "", "YAML or JSON topology file describing the routers to create")
+	name := fs.String("name", "", "name of the testnet, prefixes all of its Docker resources")
+	parallel := fs.Int("parallel", testnet.DEFAULT_PARALLEL, "number of routers to create at the same time")
+	subnet := fs.String("subnet", "", "IPv4 subnet of the testnet network in CIDR notation, default the first free /16")
+	ipv6 := fs.Bool("ipv6", false, "create a dual-stack network with an IPv6 subnet as well")
+	subnet6 := fs.String("subnet6", "", "IPv6 subnet of a dual-stack network in CIDR notation, implies --ipv6 (default a random unique local /64)")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	for _, s := range []string{*subnet, *subnet6} {
+		if s == "" {
+			continue
+		}
+		if _, err := docker_control.ParseSubnet(s); err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	if *subnet6 != "" {
+		*ipv6 = true
+	}
+	if running() {
+		return fmt.Errorf("testnet %s is already running", testnetName)
+	}
+	if *name != "" {
+		if err := setTestnetName(*name); err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	if state.Exists(statePath) {
+		return fmt.Errorf("testnet %s from an earlier session is recorded in %s, use 'attach' to manage it or pick another --name", testnetName, statePath)
+	}
+
+	var t *topology.Topology
+	if *topologyPath != "" {
+		var err error
+		t, err = topology.Load(*topologyPath)
+		if err != nil {
+			return fmt.Errorf("failed to load topology: %v", err)
+		}
+	}
+	if err := start(cli, ctx, *subnet, *ipv6, *subnet6); err != nil {
+		return fmt.Errorf("failed to start testnet: %v", err)
+	}
+	if t != nil {
+		if err := applyTopology(ctx, t, *parallel); err != nil {
+			return fmt.Errorf("failed to bring up topology: %v", err)
+		}
+	}
+	return nil
+}
+
+func cmdStop(cli *client.Client, ctx context.Context, args []string) error {
+	if !running() {
+		return errNotRunning
+	}
+	shutdown(ctx)
+	return nil
+}
+
+func cmdAttach(cli *client.Client, ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		if running() && args[0] != testnetName {
+			return fmt.Errorf("already managing testnet %s, stop it or exit first", testnetName)
+		}
+		if err := setTestnetName(args[0]); err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	if err := attach(cli, ctx); err != nil {
+		return fmt.Errorf("failed to attach: %v", err)
+	}
+	return nil
+}
+
+func cmdList(cli *client.Client, ctx context.Context, args []string) error {
+	names, err := state.List()
+	if err != nil {
+		return fmt.Errorf("failed to list testnets: %v", err)
+	}
+	if len(names) == 0 {
+		fmt.Println("No testnets found.")
+		return nil
+	}
+	fmt.Printf("%-24s %-14s %-18s %s\n", "NAME", "ID", "SUBNET", "ROUTERS")
+	for _, name := range names {
+		path, err := state.PathFor(name)
+		if err != nil {
+			return err
+		}
+		s, err := state.Load(path)
+		if err != nil {
+			fmt.Printf("%-24s (unreadable state: %v)\n", name, err)
+			continue
+		}
+		fmt.Printf("%-24s %-14s %-18s %d\n", name, s.ID, s.Subnet, len(s.Routers))
+	}
+	return nil
+}
+
+func cmdStatus(cli *client.Client, ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the status as JSON")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	return status(ctx, *asJSON)
+}
+
+func cmdUsage(cli *client.Client, ctx context.Context, args []string) error {
+	if !running() {
+		return errNotRunning
+	}
+	usage(cli, ctx)
+	return nil
+}
+
+func cmdBuild(cli *client.Client, ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	src := fs.String("src", "", "build the go-i2p image from this local git checkout instead of upstream master")
+	version := fs.String("version", "", "build the images at this version: a git ref for go-i2p, a release for i2pd and java")
+	kinds, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	pinned := docker_control.NormalizeVersion(*version) != docker_control.VERSION_LATEST
+	if *src != "" && pinned {
+		return usageError{"--src and --version can't be used together, a --src image is tagged with its commit"}
+	}
+	// A pinned version only adds an image, it doesn't replace the one running routers use
+	if running() && !pinned {
+		return errors.New("testnet is running, not safe to build")
+	}
+
+	if *src != "" {
+		if len(kinds) != 1 {
+			return usageError{"--src builds a single kind: build goi2p --src <path>"}
+		}
+		k, _ := nodekind.Lookup(kinds[0])
+		builder, ok := k.(nodekind.SourceBuilder)
+		if !ok {
+			return usageError{fmt.Sprintf("%s images can't be built from a local checkout", kinds[0])}
+		}
+		tag, err := builder.BuildImageFromSource(cli, ctx, *src)
+		if err != nil {
+			return fmt.Errorf("failed to build image: %v", err)
+		}
+		fmt.Printf("Built %s from %s\n", tag, *src)
+		return nil
+	}
+
+	if len(kinds) == 0 && !pinned {
+		if err := buildImages(cli, ctx); err != nil {
+			return fmt.Errorf("failed to build images: %v", err)
+		}
+		return nil
+	}
+	if len(kinds) == 0 {
+		return usageError{"specify the kinds to build at a version, e.g. build i2pd --version 2.54.0"}
+	}
+	for _, kind := range kinds {
+		if err := buildImage(cli, ctx, topology.NormalizeKind(kind), *version); err != nil {
+			return fmt.Errorf("failed to build images: %v", err)
+		}
+	}
+	return nil
+}
+
+func cmdRebuild(cli *client.Client, ctx context.Context, args []string) error {
+	if running() {
+		return errors.New("testnet is running, not safe to rebuild")
+	}
+	if err := rebuildImages(cli, ctx); err != nil {
+		return fmt.Errorf("failed to rebuild images: %v", err)
+	}
+	return nil
+}
+
+func cmdRemoveImages(cli *client.Client, ctx context.Context, args []string) error {
+	if running() {
+		return errors.New("testnet is running, not safe to remove images")
+	}
+	if err := removeImages(cli, ctx); err != nil {
+		return fmt.Errorf("failed to remove images: %v", err)
+	}
+	return nil
+}
+
+func cmdAdd(cli *client.Client, ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	kind := fs.String("kind", "", "kind of router to add ("+strings.Join(nodekind.Names(), ", ")+")")
+	count := fs.Int("count", 1, "number of routers to add")
+	floodfill := fs.Bool("floodfill", false, "configure the new routers as floodfills")
+	parallel := fs.Int("parallel", testnet.DEFAULT_PARALLEL, "number of routers to create at the same time")
+	version := fs.String("version", "", "image version to run, built first if missing: a git ref for go-i2p, a release for i2pd and java (default latest)")
+	family := fs.String("address-family", "", "address family of the new routers: ipv4, ipv6 or dual (default dual on a dual-stack testnet, else ipv4)")
+	var nat natFlag
+	fs.Var(&nat, "behind-nat", "put each router on a private network behind a NAT gateway: full-cone or symmetric (default full-cone)")
+	publish := fs.Bool("publish", false, "publish the console, proxies, SAM, I2CP and I2PControl of the new routers on host ports")
+	transports := fs.String("transports", "", "comma-separated transports the new routers enable: ntcp2, ssu2 (default both, go-i2p always runs both)")
+	publishedTransports := fs.String("published-transports", "", "comma-separated transports the new routers publish, or none (default every enabled one, go-i2p always publishes both)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	positional = nat.takeValue(positional)
+	// Also accept the interactive form: add <kind> [count]
+	if len(positional) > 0 && *kind == "" {
+		*kind = positional[0]
+		positional = positional[1:]
+	}
+	if len(positional) > 0 {
+		*count, err = strconv.Atoi(positional[0])
+		if err != nil {
+			return usageError{fmt.Sprintf("invalid router count %q", positional[0])}
+		}
+	}
+	if *kind == "" {
+		return usageError{"specify the type of router to add. Usage: add [" + strings.Join(kindNames("_router"), "|") + "] [count]"}
+	}
+	if *count < 1 {
+		return usageError{"router count must be at least 1"}
+	}
+	if *parallel < 1 {
+		return usageError{"--parallel must be at least 1"}
+	}
+	if err := topology.ValidateAddressFamily(*family); err != nil {
+		return usageError{err.Error()}
+	}
+
+	if nat.nat != "" && *family != "" && *family != topology.FAMILY_IPV4 {
+		return usageError{"routers behind a NAT only use IPv4, --address-family must be ipv4"}
+	}
+	if !running() {
+		return errNotRunning
+	}
+
+	opts := topology.NodeOptions{Version: *version, AddressFamily: *family, NAT: nat.nat}
+	if *floodfill {
+		opts.Floodfill = floodfill
+	}
+	if *publish {
+		opts.Publish = publish
+	}
+	if err := opts.SetTransports(*transports, *publishedTransports); err != nil {
+		return usageError{err.Error()}
+	}
+	k, ok := nodekind.Lookup(*kind)
+	if !ok {
+		return usageError{"unknown router type. Available types: " + strings.Join(kindNames("_router"), ", ")}
+	}
+	if err := opts.CheckTransports(k); err != nil {
+		return usageError{err.Error()}
+	}
+	specs := make([]testnet.RouterSpec, *count)
+	for i := range specs {
+		specs[i] = testnet.RouterSpec{Kind: *kind, Options: opts}
+	}
+	if err := createRouters(ctx, specs, *parallel); err != nil {
+		return fmt.Errorf("failed to add routers: %v", err)
+	}
+	return nil
+}
+
+// nodeCommand builds the command running a lifecycle action on individual routers
+func nodeCommand(action string) func(cli *client.Client, ctx context.Context, args []string) error {
+	return func(cli *client.Client, ctx context.Context, args []string) error {
+		fs := flag.NewFlagSet(action, flag.ContinueOnError)
+		timeout := fs.Int("timeout", -1, "seconds to wait for a graceful shutdown before the router is killed (default depends on the router kind)")
+		nodes, err := parseFlags(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return usageError{fmt.Sprintf("usage: %s [--timeout <seconds>] <node>...", action)}
+		}
+		if !running() {
+			return errNotRunning
+		}
+
+		for _, node := range nodes {
+			r, err := tn.Router(node)
+			if err != nil {
+				return err
+			}
+			err = nodeAction(ctx, action, r, *timeout)
+			if action == "remove" {
+				persistState()
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s\n", action, r.Name)
+		}
+		return nil
+	}
+}
+
+func cmdWaitReady(cli *client.Client, ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("wait-ready", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", DEFAULT_READY_TIMEOUT, "how long to wait before giving up")
+	tunnels := fs.Bool("tunnels", false, "also wait until the routers have built a tunnel")
+	nodes, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if !running() {
+		return errNotRunning
+	}
+
+	var routers []state.Router
+	for _, node := range nodes {
+		if node == "all" {
+			routers = nil
+			break
+		}
+		r, err := tn.Router(node)
+		if err != nil {
+			return err
+		}
+		routers = append(routers, r)
+	}
+	if len(routers) == 0 {
+		routers = tn.Routers()
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	if err := tn.WaitReady(waitCtx, *tunnels, routers...); err != nil {
+		return err
+	}
+	fmt.Printf("%d routers are ready\n", len(routers))
+	return nil
+}
+
+func cmdSaveTopology(cli *client.Client, ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return usageError{"usage: save_topology <file.yaml|file.json>"}
+	}
+	if !running() {
+		return errNotRunning
+	}
+	if err := topology.Save(args[0], tn.Topology()); err != nil {
+		return fmt.Errorf("failed to save topology: %v", err)
+	}
+	fmt.Printf("Saved topology to %s\n", args[0])
+	return nil
+}
+
+func cmdLogs(cli *client.Client, ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	tail := fs.String("tail", "100", "number of lines to show from the end of the log, or all")
+	level := fs.String("level", "", "only show lines of at least this level: debug, info, warn or error")
+	nodes, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(nodes) != 1 {
+		return usageError{"usage: logs [--tail <n>] [--level <level>] <node>"}
+	}
+	if *level != "" && nodekind.NormalizeLevel(*level) == "" {
+		return usageError{fmt.Sprintf("unknown log level %q, use debug, info, warn or error", *level)}
+	}
+	if !running() {
+		return errNotRunning
+	}
+	r, err := tn.Router(nodes[0])
+	if err != nil {
+		return err
+	}
+	entries, err := tn.LogEntries(ctx, r, *tail)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.AtLeast(*level) {
+			fmt.Println(entry.Line)
+		}
+	}
+	return nil
+}
+
+func cmdNetem(cli *client.Client, ctx context.Context, args []string) error {
+	const usage = "usage: netem <node> [delay <d>] [jitter <d>] [loss <percent>] [rate <rate>] | netem <node> clear"
+	if len(args) == 0 {
+		return usageError{usage}
+	}
+	// A nil n clears the conditions
+	var n *topology.Netem
+	if len(args) > 1 && !(len(args) == 2 && args[1] == "clear") {
+		var err error
+		if n, err = topology.ParseNetem(args[1:]); err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	if !running() {
+		return errNotRunning
+	}
+	r, err := tn.Router(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Without options the current conditions are shown
+	if len(args) > 1 {
+		if r, err = tn.SetNetem(ctx, r, n); err != nil {
+			return err
+		}
+	}
+	out, err := tn.NetemStatus(ctx, r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s\n", r.Name, r.Options.Netem)
+	fmt.Print(out)
+	return nil
+}
+
+// printPartition lists the routers of each partition group
+func printPartition(partition map[string][]string) {
+	if len(partition) == 0 {
+		fmt.Println("The testnet isn't partitioned.")
+		return
+	}
+	groups := make([]string, 0, len(partition))
+	for group := range partition {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	fmt.Println("Partition groups:")
+	for _, group := range groups {
+		fmt.Printf("  %s: %s\n", group, strings.Join(partition[group], ", "))
+	}
+}
+
+func cmdPartition(cli *client.Client, ctx context.Context, args []string) error {
+	const usage = "usage: partition <group>=<node>[,<node>...] [<group>=<node>[,<node>...]...]"
+	if !running() {
+		return errNotRunning
+	}
+	if len(args) == 0 {
+		printPartition(tn.Partition())
+		return nil
+	}
+	groups := map[string][]state.Router{}
+	for _, arg := range args {
+		group, nodes, ok := strings.Cut(arg, "=")
+		if !ok || group == "" || nodes == "" {
+			return usageError{usage}
+		}
+		if _, dup := groups[group]; dup {
+			return usageError{fmt.Sprintf("group %s is given twice", group)}
+		}
+		for _, node := range strings.Split(nodes, ",") {
+			r, err := tn.Router(node)
+			if err != nil {
+				return err
+			}
+			groups[group] = append(groups[group], r)
+		}
+	}
+	if err := tn.PartitionRouters(ctx, groups); err != nil {
+		// The partition is recorded even if some routers couldn't be changed, so restarting them applies it
+		persistState()
+		return err
+	}
+	printPartition(tn.Partition())
+	return nil
+}
+
+func cmdHeal(cli *client.Client, ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return usageError{"usage: heal"}
+	}
+	if !running() {
+		return errNotRunning
+	}
+	if err := tn.Heal(ctx); err != nil {
+		persistState()
+		return err
+	}
+	fmt.Println("All routers can reach each other again")
+	return nil
+}
+
+// routerPorts are the published services of one router
+type routerPorts struct {
+	Name  string                  `json:"name"`
+	Ports []testnet.PublishedPort `json:"ports"`
+}
+
+func cmdPorts(cli *client.Client, ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ports", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the mapping as JSON")
+	nodes, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if !running() {
+		return errNotRunning
+	}
+
+	routers := tn.Routers()
+	if len(nodes) > 0 {
+		routers = nil
+		for _, node := range nodes {
+			r, err := tn.Router(node)
+			if err != nil {
+				return err
+			}
+			if !r.Options.IsPublished() {
+				return fmt.Errorf("router %s doesn't publish its services, add routers with --publish", r.Name)
+			}
+			routers = append(routers, r)
+		}
+	}
+	var published []routerPorts
+	for _, r := range routers {
+		ports, err := tn.Ports(ctx, r)
+		if err != nil {
+			return err
+		}
+		if ports != nil {
+			published = append(published, routerPorts{Name: r.Name, Ports: ports})
+		}
+	}
+
+	if *asJSON {
+		return printJSON(published)
+	}
+	if len(published) == 0 {
+		fmt.Println("No router publishes its services, add routers with --publish")
+	}
+	for _, r := range published {
+		fmt.Printf("%s:\n", r.Name)
+		for _, p := range r.Ports {
+			host := p.Host
+			if host == "" {
+				host = "not running"
+			}
+			fmt.Printf("  %-12s %5d -> %s\n", p.Service, p.Port, host)
+		}
+	}
+	return nil
+}
+
+func cmdSync(cli *client.Client, ctx context.Context, args []string) error {
+	if err := cmdSyncShared(cli, ctx, args); err != nil {
+		return err
+	}
+	return cmdSyncNetDb(cli, ctx, args)
+}
+
+func cmdSyncShared(cli *client.Client, ctx context.Context, args []string) error {
+	if !running() {
+		return errNotRunning
+	}
+	if err := tn.SyncToShared(ctx); err != nil {
+		return err
+	}
+	fmt.Printf("Synced the netDb of %d routers to the shared volume\n", len(tn.Routers()))
+	return nil
+}
+
+func cmdSyncNetDb(cli *client.Client, ctx context.Context, args []string) error {
+	if !running() {
+		return errNotRunning
+	}
+	if err := tn.SyncFromShared(ctx); err != nil {
+		return err
+	}
+	fmt.Printf("Synced the shared netDb into %d routers\n", len(tn.Routers()))
+	return nil
+}
+
+func cmdPrune(cli *client.Client, ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only list the resources that would be removed")
+	all := fs.Bool("all", false, "prune leftovers of every testnet, not just the selected one")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Never prune the testnet this session manages, nor any testnet recorded in a state file that could still be attached
+	protected := map[string]bool{}
+	if running() {
+		protected[tn.ID()] = true
+	}
+	names, err := state.List()
+	if err != nil {
+		return fmt.Errorf("failed to list testnets: %v", err)
+	}
+	for _, name := range names {
+		path, err := state.PathFor(name)
+		if err != nil {
+			return err
+		}
+		if s, err := state.Load(path); err == nil {
+			protected[s.ID] = true
+		}
+	}
+
+	resources, err := docker_control.ListTestnetResources(cli, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list testnet resources: %v", err)
+	}
+	var leftovers []docker_control.Resource
+	for _, r := range resources {
+		if protected[r.TestnetID] || (!*all && r.TestnetName != testnetName) {
+			continue
+		}
+		leftovers = append(leftovers, r)
+	}
+	if len(leftovers) == 0 {
+		fmt.Println("No leftover testnet resources found.")
+		return nil
+	}
+
+	fmt.Printf("%-10s %-48s %-24s %-14s %-10s\n", "TYPE", "NAME", "TESTNET", "ID", "ROLE")
+	for _, r := range leftovers {
+		fmt.Printf("%-10s %-48s %-24s %-14s %-10s\n", r.Type, r.Name, r.TestnetName, r.TestnetID, r.Role)
+	}
+	if *dryRun {
+		fmt.Printf("%d resources would be removed\n", len(leftovers))
+		return nil
+	}
+
+	failed := 0
+	for _, r := range leftovers {
+		if err := docker_control.RemoveResource(cli, ctx, r); err != nil {
+			failed++
+			fmt.Println(err)
+		}
+	}
+	fmt.Printf("Removed %d of %d leftover resources\n", len(leftovers)-failed, len(leftovers))
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d resources", failed)
+	}
+	return nil
+}
+
+// runCLI executes a single subcommand against the testnet recorded in the state file and returns the exit code
+func runCLI(cli *client.Client, ctx context.Context, args []string) int {
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		showHelp()
+		return 0
+	}
+
+	if err := loadState(cli); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	err := runCommand(cli, ctx, args)
+	var uerr usageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &uerr):
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+)
+
+// testnetImages lists every local image of the given router kinds, all kinds if none are given, and the helper
+// images accessing volumes and emulating link conditions. With ensureHelpers, missing helper images are fetched first.
+func testnetImages(cli *client.Client, ctx context.Context, kinds []string, ensureHelpers bool) ([]docker_control.BundleImage, error) {
+	var selected []nodekind.NodeKind
+	if len(kinds) == 0 {
+		selected = nodekind.All()
+	}
+	for _, name := range kinds {
+		k, ok := nodekind.Lookup(name)
+		if !ok {
+			return nil, usageError{fmt.Sprintf("unknown router kind %q, available kinds are %s", name, kindList(""))}
+		}
+		selected = append(selected, k)
+	}
+
+	var images []docker_control.BundleImage
+	for _, k := range selected {
+		tags, err := docker_control.ImageTags(cli, ctx, docker_control.ImageRepository(k.Image("")))
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			images = append(images, docker_control.BundleImage{Image: tag, Kind: k.Name()})
+		}
+	}
+	if ensureHelpers {
+		if err := docker_control.PullHelperImage(cli, ctx); err != nil {
+			return nil, fmt.Errorf("error getting the helper image: %v", err)
+		}
+		if err := docker_control.BuildNetemImage(cli, ctx); err != nil {
+			return nil, fmt.Errorf("error building the netem image: %v", err)
+		}
+	}
+	for _, helper := range []string{docker_control.HELPER_IMAGE, docker_control.NETEM_IMAGE} {
+		tags, err := docker_control.ImageTags(cli, ctx, docker_control.ImageRepository(helper))
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			if tag == helper || tag == helper+":latest" {
+				images = append(images, docker_control.BundleImage{Image: tag})
+			}
+		}
+	}
+	return docker_control.DescribeImages(cli, ctx, images)
+}
+
+// printImages lists images with their kind and version
+func printImages(images []docker_control.BundleImage) {
+	for _, img := range images {
+		kind := img.Kind
+		if kind == "" {
+			kind = "helper"
+		}
+		version := img.Version
+		if img.Commit != "" {
+			version = "local checkout " + img.Commit
+		}
+		if version == "" {
+			version = "-"
+		}
+		fmt.Printf("%-40s Kind: %-14s Version: %s\n", img.Image, kind, version)
+	}
+}
+
+func cmdImages(cli *client.Client, ctx context.Context, args []string) error {
+	const usage = "usage: images list | images export <bundle.tar> [kind...] | images import <bundle.tar>"
+	if len(args) == 0 {
+		return usageError{usage}
+	}
+	fs := flag.NewFlagSet("images "+args[0], flag.ContinueOnError)
+	rest, err := parseFlags(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		if len(rest) != 0 {
+			return usageError{usage}
+		}
+		images, err := testnetImages(cli, ctx, nil, false)
+		if err != nil {
+			return err
+		}
+		printImages(images)
+	case "export":
+		if len(rest) == 0 {
+			return usageError{usage}
+		}
+		images, err := testnetImages(cli, ctx, rest[1:], true)
+		if err != nil {
+			return err
+		}
+		manifest, err := docker_control.ExportImageBundle(cli, ctx, rest[0], images)
+		if err != nil {
+			return err
+		}
+		printImages(manifest.Images)
+		fmt.Printf("Exported %d images to %s\n", len(manifest.Images), rest[0])
+	case "import":
+		if len(rest) != 1 {
+			return usageError{usage}
+		}
+		manifest, err := docker_control.ImportImageBundle(cli, ctx, rest[0])
+		if err != nil {
+			return err
+		}
+		printImages(manifest.Images)
+		fmt.Printf("Imported %d images from %s, exported %s\n", len(manifest.Images), rest[0], manifest.Created.Format("2006-01-02 15:04"))
+	default:
+		return usageError{usage}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"go-i2p-testnet/lib/customkind"
+	"go-i2p-testnet/lib/state"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// TESTNET_KINDS_ENV names a kinds file declaring custom router kinds when --kinds is not given
+	TESTNET_KINDS_ENV = "TESTNET_KINDS"
+	// DEFAULT_KINDS_FILE is loaded from the state directory if it exists and no other kinds file is named
+	DEFAULT_KINDS_FILE = "kinds.yaml"
+)
+
+// defaultKindsFile returns the kinds file named by TESTNET_KINDS, or the one in the state directory if it exists
+func defaultKindsFile() string {
+	if path := os.Getenv(TESTNET_KINDS_ENV); path != "" {
+		return path
+	}
+	dir, err := state.Dir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, DEFAULT_KINDS_FILE)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// loadKinds registers the custom router kinds declared in a kinds file, if one is given
+func loadKinds(path string) error {
+	if path == "" {
+		return nil
+	}
+	names, err := customkind.RegisterFile(path)
+	if err != nil {
+		return err
+	}
+	log.WithFields(map[string]interface{}{
+		"path":  path,
+		"kinds": names,
+	}).Info("Loaded custom router kinds")
+	return nil
+}
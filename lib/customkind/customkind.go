@@ -0,0 +1,218 @@
+package customkind
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/utils/logger"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	// The built-in kinds provide the config formats and log parsers custom kinds reuse
+	_ "go-i2p-testnet/lib/go-i2p"
+	_ "go-i2p-testnet/lib/i2pd"
+	_ "go-i2p-testnet/lib/i2pjava"
+)
+
+var log = logger.GetTestnetLogger()
+
+const (
+	// FORMAT_TEMPLATE renders the config file from Config.Template
+	FORMAT_TEMPLATE = "template"
+	// FORMAT_NONE writes no config file, for images that need none or bring their own
+	FORMAT_NONE = "none"
+	// DEFAULT_STOP_SIGNAL is sent to stop a custom router unless its definition names another
+	DEFAULT_STOP_SIGNAL = "SIGTERM"
+	// DEFAULT_STOP_TIMEOUT is how many seconds a custom router gets to shut down unless its definition says otherwise
+	DEFAULT_STOP_TIMEOUT = 10
+)
+
+// File is a kinds file, declaring router kinds besides the built-in ones
+type File struct {
+	Kinds []Definition `yaml:"kinds" json:"kinds"`
+}
+
+// Definition declares a router kind
+type Definition struct {
+	Name    string   `yaml:"name" json:"name"`
+	Aliases []string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	// Image is the image routers run. With a version, its tag is replaced by the version.
+	Image string `yaml:"image,omitempty" json:"image,omitempty"`
+	// Dockerfile builds the image instead of pulling it, with the directory holding it as the build context.
+	// A relative path is relative to the kinds file. The version is passed in the VERSION build argument.
+	Dockerfile string `yaml:"dockerfile,omitempty" json:"dockerfile,omitempty"`
+
+	// DataDir is where the router keeps its configuration and data, the router's volume is mounted there
+	DataDir string `yaml:"data_dir" json:"data_dir"`
+	// RouterInfo is the file the router writes its RouterInfo to, empty if it doesn't write one
+	RouterInfo string `yaml:"router_info,omitempty" json:"router_info,omitempty"`
+	// NetDb is the directory the router reads its netDb from, netDb by default
+	NetDb  string `yaml:"netdb,omitempty" json:"netdb,omitempty"`
+	Config Config `yaml:"config" json:"config"`
+
+	Command     []string `yaml:"command,omitempty" json:"command,omitempty"`
+	Env         []string `yaml:"env,omitempty" json:"env,omitempty"`
+	User        string   `yaml:"user,omitempty" json:"user,omitempty"`
+	StopSignal  string   `yaml:"stop_signal,omitempty" json:"stop_signal,omitempty"`
+	StopTimeout int      `yaml:"stop_timeout,omitempty" json:"stop_timeout,omitempty"`
+
+	// Console is the URL of the router's console, probed from inside the container. $IP is replaced by the router's address.
+	Console string `yaml:"console,omitempty" json:"console,omitempty"`
+	// TransportsPort is the port the router's transports listen on, 0 for any port not bound to loopback
+	TransportsPort *int `yaml:"transports_port,omitempty" json:"transports_port,omitempty"`
+	// LogFormat names the kind whose log format the router uses, by default the config format
+	LogFormat string `yaml:"log_format,omitempty" json:"log_format,omitempty"`
+}
+
+// Config describes the router's config file. Paths in a definition are relative to its DataDir.
+type Config struct {
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Format is the name of the kind whose config generator is used, FORMAT_TEMPLATE or FORMAT_NONE
+	Format string `yaml:"format" json:"format"`
+	// Template is a text/template rendered with the router's ID, Name, IP, Floodfill and Version
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+}
+
+// validName keeps kind names usable in container and volume names
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*$`)
+
+// Load reads a kinds file from YAML or JSON, chosen by the file extension
+func Load(filePath string) ([]*Kind, error) {
+	log.WithField("path", filePath).Debug("Loading kinds file")
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading kinds file: %v", err)
+	}
+
+	f := &File{}
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		err = json.Unmarshal(data, f)
+	} else {
+		err = yaml.Unmarshal(data, f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing kinds file %s: %v", filePath, err)
+	}
+
+	kinds := make([]*Kind, 0, len(f.Kinds))
+	for _, def := range f.Kinds {
+		k, err := newKind(def, filepath.Dir(filePath))
+		if err != nil {
+			return nil, fmt.Errorf("error in kinds file %s: %v", filePath, err)
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
+
+// RegisterFile loads a kinds file and registers its kinds, returning their names
+func RegisterFile(filePath string) ([]string, error) {
+	kinds, err := Load(filePath)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		if err := nodekind.Register(k); err != nil {
+			return names, fmt.Errorf("error registering kind from %s: %v", filePath, err)
+		}
+		names = append(names, k.Name())
+	}
+	log.WithFields(map[string]interface{}{
+		"path":  filePath,
+		"kinds": names,
+	}).Debug("Registered custom router kinds")
+	return names, nil
+}
+
+// inDataDir returns p relative to dataDir, failing if an absolute p lies outside of it
+func inDataDir(dataDir string, p string) (string, error) {
+	if !path.IsAbs(p) {
+		return path.Clean(p), nil
+	}
+	rel := strings.TrimPrefix(path.Clean(p), dataDir+"/")
+	if rel == path.Clean(p) {
+		return "", fmt.Errorf("%s is outside of the data dir %s", p, dataDir)
+	}
+	return rel, nil
+}
+
+// newKind checks a definition and fills in its defaults. A relative Dockerfile is resolved against baseDir.
+func newKind(def Definition, baseDir string) (*Kind, error) {
+	if !validName.MatchString(def.Name) {
+		return nil, fmt.Errorf("invalid kind name %q, use lowercase letters, digits, dots and dashes", def.Name)
+	}
+	if def.Image == "" && def.Dockerfile == "" {
+		return nil, fmt.Errorf("kind %s needs an image or a dockerfile", def.Name)
+	}
+	if def.Dockerfile != "" && !filepath.IsAbs(def.Dockerfile) {
+		def.Dockerfile = filepath.Join(baseDir, def.Dockerfile)
+	}
+	if !path.IsAbs(def.DataDir) {
+		return nil, fmt.Errorf("kind %s needs an absolute data_dir, got %q", def.Name, def.DataDir)
+	}
+	def.DataDir = path.Clean(def.DataDir)
+
+	var err error
+	if def.RouterInfo != "" {
+		if def.RouterInfo, err = inDataDir(def.DataDir, def.RouterInfo); err != nil {
+			return nil, fmt.Errorf("router_info of kind %s: %v", def.Name, err)
+		}
+	}
+	if def.NetDb == "" {
+		def.NetDb = "netDb"
+	}
+	if def.NetDb, err = inDataDir(def.DataDir, def.NetDb); err != nil {
+		return nil, fmt.Errorf("netdb of kind %s: %v", def.Name, err)
+	}
+
+	k := &Kind{def: def}
+	switch def.Config.Format {
+	case FORMAT_NONE:
+	case FORMAT_TEMPLATE:
+		if k.template, err = template.New(def.Name).Parse(def.Config.Template); err != nil {
+			return nil, fmt.Errorf("config template of kind %s: %v", def.Name, err)
+		}
+	case "":
+		return nil, fmt.Errorf("kind %s needs a config format: one of %s, %s or %s", def.Name, strings.Join(nodekind.Names(), ", "), FORMAT_TEMPLATE, FORMAT_NONE)
+	default:
+		format, ok := nodekind.Lookup(def.Config.Format)
+		if !ok {
+			return nil, fmt.Errorf("unknown config format %q of kind %s, use one of %s, %s or %s", def.Config.Format, def.Name, strings.Join(nodekind.Names(), ", "), FORMAT_TEMPLATE, FORMAT_NONE)
+		}
+		k.format = format
+	}
+	if def.Config.Format != FORMAT_NONE {
+		if def.Config.Path == "" {
+			return nil, fmt.Errorf("kind %s needs a config path", def.Name)
+		}
+		if k.def.Config.Path, err = inDataDir(def.DataDir, def.Config.Path); err != nil {
+			return nil, fmt.Errorf("config path of kind %s: %v", def.Name, err)
+		}
+	}
+
+	logFormat := def.LogFormat
+	if logFormat == "" && k.format != nil {
+		logFormat = k.format.Name()
+	}
+	if logFormat != "" {
+		parser, ok := nodekind.Lookup(logFormat)
+		if !ok {
+			return nil, fmt.Errorf("unknown log format %q of kind %s, use one of %s", logFormat, def.Name, strings.Join(nodekind.Names(), ", "))
+		}
+		k.logParser = parser
+	}
+
+	if k.def.StopSignal == "" {
+		k.def.StopSignal = DEFAULT_STOP_SIGNAL
+	}
+	if k.def.StopTimeout == 0 {
+		k.def.StopTimeout = DEFAULT_STOP_TIMEOUT
+	}
+	return k, nil
+}
@@ -0,0 +1,143 @@
+package customkind
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// Kind is a router kind declared in a kinds file
+type Kind struct {
+	def Definition
+	// format generates the config file, nil for FORMAT_TEMPLATE and FORMAT_NONE
+	format   nodekind.NodeKind
+	template *template.Template
+	// logParser parses the router's log lines, nil if its log format is unknown
+	logParser nodekind.NodeKind
+}
+
+func (k *Kind) Name() string      { return k.def.Name }
+func (k *Kind) Aliases() []string { return k.def.Aliases }
+
+// Definition returns the definition the kind was declared with, its defaults filled in
+func (k *Kind) Definition() Definition { return k.def }
+
+// repository returns the image name without its tag
+func (k *Kind) repository() string {
+	if k.def.Image == "" {
+		return k.def.Name + "-node"
+	}
+	return docker_control.ImageRepository(k.def.Image)
+}
+
+func (k *Kind) Image(version string) string {
+	version = docker_control.NormalizeVersion(version)
+	if version == docker_control.VERSION_LATEST && k.def.Image != "" {
+		return k.def.Image
+	}
+	return k.repository() + ":" + docker_control.VersionTag(version)
+}
+
+// BuildImage builds the image from the kind's Dockerfile, or pulls it if the kind only names an image
+func (k *Kind) BuildImage(cli *client.Client, ctx context.Context, version string) error {
+	version = docker_control.NormalizeVersion(version)
+	if k.def.Dockerfile == "" {
+		return docker_control.PullDockerImage(cli, ctx, k.Image(version))
+	}
+	var buildArgs map[string]*string
+	if version != docker_control.VERSION_LATEST {
+		buildArgs = map[string]*string{"VERSION": &version}
+	}
+	labels := map[string]string{docker_control.LABEL_VERSION: version}
+	return docker_control.BuildDockerImageFromDir(cli, ctx, k.Image(version), k.def.Dockerfile, buildArgs, labels)
+}
+
+func (k *Kind) RemoveImage(cli *client.Client, ctx context.Context) error {
+	return docker_control.RemoveRepositoryImages(cli, ctx, k.repository())
+}
+
+func (k *Kind) DataDir() string { return k.def.DataDir }
+
+func (k *Kind) RouterInfoPath() string {
+	if k.def.RouterInfo == "" {
+		return ""
+	}
+	return path.Join(k.def.DataDir, k.def.RouterInfo)
+}
+
+func (k *Kind) NetDbPath() string { return path.Join(k.def.DataDir, k.def.NetDb) }
+
+// Transports lists the transports the kind's config format can disable or leave unpublished, none for templates
+func (k *Kind) Transports() []string {
+	if selector, ok := k.format.(nodekind.TransportSelector); ok {
+		return selector.Transports()
+	}
+	return nil
+}
+
+// Config writes the config in the kind's format to its config path. When the format's kind generates
+// several files, the first goes to the config path and the others next to it.
+func (k *Kind) Config(r nodekind.Router) ([]nodekind.File, error) {
+	switch {
+	case k.template != nil:
+		var out bytes.Buffer
+		if err := k.template.Execute(&out, r); err != nil {
+			return nil, fmt.Errorf("error rendering config template of kind %s: %v", k.def.Name, err)
+		}
+		return []nodekind.File{{Path: k.def.Config.Path, Content: out.String()}}, nil
+	case k.format != nil:
+		files, err := k.format.Config(r)
+		if err != nil {
+			return nil, err
+		}
+		dir := path.Dir(k.def.Config.Path)
+		for i := range files {
+			if i == 0 {
+				files[i].Path = k.def.Config.Path
+			} else {
+				files[i].Path = path.Join(dir, path.Base(files[i].Path))
+			}
+		}
+		return files, nil
+	}
+	return nil, nil
+}
+
+func (k *Kind) ContainerSpec(r nodekind.Router) nodekind.ContainerSpec {
+	return nodekind.ContainerSpec{
+		Cmd:         k.def.Command,
+		Env:         k.def.Env,
+		User:        k.def.User,
+		StopSignal:  k.def.StopSignal,
+		StopTimeout: k.def.StopTimeout,
+	}
+}
+
+// Probes checks what the definition tells about the router: its RouterInfo, console and transports
+func (k *Kind) Probes() []nodekind.Probe {
+	var probes []nodekind.Probe
+	if k.def.RouterInfo != "" {
+		probes = append(probes, nodekind.Probe{Name: nodekind.PROBE_ROUTER_INFO, Check: nodekind.FileProbe(k.RouterInfoPath())})
+	}
+	if k.def.Console != "" {
+		console := func(r nodekind.Router) string { return strings.ReplaceAll(k.def.Console, "$IP", r.Address()) }
+		probes = append(probes, nodekind.Probe{Name: nodekind.PROBE_CONSOLE, Check: nodekind.ConsoleProbe(console)})
+	}
+	if k.def.TransportsPort != nil {
+		probes = append(probes, nodekind.Probe{Name: nodekind.PROBE_TRANSPORTS, Check: nodekind.TransportsProbe(*k.def.TransportsPort)})
+	}
+	return probes
+}
+
+func (k *Kind) ParseLogLine(line string) nodekind.LogEntry {
+	if k.logParser == nil {
+		return nodekind.UnparsedLine(line)
+	}
+	return k.logParser.ParseLogLine(line)
+}
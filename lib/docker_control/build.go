@@ -0,0 +1,145 @@
+package docker_control
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/docker/docker/client"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const (
+	// LABEL_CONTEXT_HASH holds the hash of the build context, Dockerfile and build arguments an image was built from
+	LABEL_CONTEXT_HASH = "org.go-i2p.testnet.context-hash"
+	// BUILD_LOG_DIR_ENV overrides the directory build logs are written to
+	BUILD_LOG_DIR_ENV = "TESTNET_BUILD_LOG_DIR"
+)
+
+// BuildLogDir returns the directory build logs are written to, honouring TESTNET_BUILD_LOG_DIR
+func BuildLogDir() (string, error) {
+	if dir := os.Getenv(BUILD_LOG_DIR_ENV); dir != "" {
+		return dir, nil
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding cache directory: %v", err)
+	}
+	return filepath.Join(cache, "go-i2p-testnet", "build-logs"), nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// createBuildLog creates the file the output of building imageName is saved to
+func createBuildLog(imageName string) (*os.File, error) {
+	dir, err := BuildLogDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating build log directory: %v", err)
+	}
+	name := unsafeFileChars.ReplaceAllString(imageName, "_") + "-" + time.Now().Format("20060102-150405") + ".log"
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("error creating build log: %v", err)
+	}
+	return f, nil
+}
+
+// contextHash hashes what an image is built from: the names, modes and contents of the files in the
+// build context, the Dockerfile used and the build arguments. Modification times are left out, so
+// checking out or copying the same files again does not cause a rebuild.
+func contextHash(buildContext []byte, dockerfile string, buildArgs map[string]*string) (string, error) {
+	h := sha256.New()
+	tr := tar.NewReader(bytes.NewReader(buildContext))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading build context: %v", err)
+		}
+		fmt.Fprintf(h, "%s\x00%c\x00%o\x00%s\x00%d\x00", hdr.Name, hdr.Typeflag, hdr.Mode, hdr.Linkname, hdr.Size)
+		if _, err := io.Copy(h, tr); err != nil {
+			return "", fmt.Errorf("error reading build context: %v", err)
+		}
+	}
+
+	fmt.Fprintf(h, "dockerfile=%s\x00", dockerfile)
+	args := make([]string, 0, len(buildArgs))
+	for arg := range buildArgs {
+		args = append(args, arg)
+	}
+	sort.Strings(args)
+	for _, arg := range args {
+		value := "<unset>"
+		if buildArgs[arg] != nil {
+			value = *buildArgs[arg]
+		}
+		fmt.Fprintf(h, "arg %s=%s\x00", arg, value)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// imageLabels returns the labels of an image, and whether the image exists
+func imageLabels(cli *client.Client, ctx context.Context, imageName string) (map[string]string, bool, error) {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, imageName)
+	if client.IsErrNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if inspect.Config == nil {
+		return nil, true, nil
+	}
+	return inspect.Config.Labels, true, nil
+}
+
+// buildIfStale builds imageName from a build context unless an image built from the same context already
+// exists. The context hash is recorded in the LABEL_CONTEXT_HASH label for the next build to compare.
+// Images built from a local checkout are kept until they are rebuilt or built from a checkout again.
+func buildIfStale(cli *client.Client, ctx context.Context, imageName string, buildContext *bytes.Buffer, dockerfile string, buildArgs map[string]*string, labels map[string]string) error {
+	hash, err := contextHash(buildContext.Bytes(), dockerfile, buildArgs)
+	if err != nil {
+		return err
+	}
+
+	current, exists, err := imageLabels(cli, ctx, imageName)
+	if err != nil {
+		log.WithError(err).Error("Failed to check if Docker image exists")
+		return fmt.Errorf("error checking for Docker image: %v", err)
+	}
+	switch {
+	case exists && current[LABEL_CONTEXT_HASH] == hash:
+		log.WithField("imageName", imageName).Debug("Docker image is up to date, skipping build")
+		return nil
+	case exists && current[LABEL_COMMIT] != "":
+		log.WithFields(map[string]interface{}{
+			"imageName": imageName,
+			"commit":    current[LABEL_COMMIT],
+		}).Debug("Docker image was built from a local checkout, skipping build")
+		return nil
+	case exists:
+		log.WithFields(map[string]interface{}{
+			"imageName": imageName,
+			"imageHash": current[LABEL_CONTEXT_HASH],
+			"hash":      hash,
+		}).Info("Docker image was built from a different build context, rebuilding")
+	}
+
+	withHash := map[string]string{LABEL_CONTEXT_HASH: hash}
+	for k, v := range labels {
+		withHash[k] = v
+	}
+	return runImageBuild(cli, ctx, buildContext, dockerfile, []string{imageName}, buildArgs, withHash)
+}
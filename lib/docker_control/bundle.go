@@ -0,0 +1,209 @@
+package docker_control
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/client"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// BUNDLE_MANIFEST is the bundle entry describing the images in it
+	BUNDLE_MANIFEST = "manifest.json"
+	// BUNDLE_IMAGES is the bundle entry holding the images, as written by docker save
+	BUNDLE_IMAGES = "images.tar"
+)
+
+// BundleImage describes an image in a bundle
+type BundleImage struct {
+	// Image is the tag the image is saved and loaded as
+	Image string `json:"image"`
+	// Kind is the router kind using the image, empty for the helper image
+	Kind        string `json:"kind,omitempty"`
+	ID          string `json:"id"`
+	Version     string `json:"version,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	ContextHash string `json:"context_hash,omitempty"`
+}
+
+// BundleManifest lists the images in a bundle
+type BundleManifest struct {
+	Created time.Time     `json:"created"`
+	Images  []BundleImage `json:"images"`
+}
+
+// describeImage fills in the ID and the version labels of a bundle image
+func describeImage(cli *client.Client, ctx context.Context, img BundleImage) (BundleImage, error) {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, img.Image)
+	if err != nil {
+		return img, fmt.Errorf("error inspecting image %s: %v", img.Image, err)
+	}
+	img.ID = inspect.ID
+	if inspect.Config != nil {
+		img.Version = inspect.Config.Labels[LABEL_VERSION]
+		img.Commit = inspect.Config.Labels[LABEL_COMMIT]
+		img.ContextHash = inspect.Config.Labels[LABEL_CONTEXT_HASH]
+	}
+	return img, nil
+}
+
+// DescribeImages fills in the ID and the version labels of images
+func DescribeImages(cli *client.Client, ctx context.Context, images []BundleImage) ([]BundleImage, error) {
+	described := make([]BundleImage, 0, len(images))
+	for _, img := range images {
+		img, err := describeImage(cli, ctx, img)
+		if err != nil {
+			return nil, err
+		}
+		described = append(described, img)
+	}
+	return described, nil
+}
+
+// addBundleEntry adds a file to a bundle, copying size bytes from r
+func addBundleEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tw, r, size)
+	return err
+}
+
+// ExportImageBundle writes images and a manifest describing them to a bundle at path, which
+// ImportImageBundle loads again on a machine without registry access
+func ExportImageBundle(cli *client.Client, ctx context.Context, path string, images []BundleImage) (*BundleManifest, error) {
+	if len(images) == 0 {
+		return nil, errors.New("no images to export")
+	}
+	images, err := DescribeImages(cli, ctx, images)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BundleManifest{Created: time.Now().UTC(), Images: images}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding bundle manifest: %v", err)
+	}
+
+	tags := make([]string, 0, len(images))
+	for _, img := range images {
+		tags = append(tags, img.Image)
+	}
+	log.WithFields(map[string]interface{}{
+		"path":   path,
+		"images": tags,
+	}).Debug("Saving images")
+
+	// The bundle's tar header needs the size of the saved images, so they go to a temporary file first
+	saved, err := os.CreateTemp(filepath.Dir(path), ".images-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer os.Remove(saved.Name())
+	defer saved.Close()
+
+	reader, err := cli.ImageSave(ctx, tags)
+	if err != nil {
+		return nil, fmt.Errorf("error saving images: %v", err)
+	}
+	size, err := io.Copy(saved, reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error saving images: %v", err)
+	}
+	if _, err := saved.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error reading saved images: %v", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating bundle: %v", err)
+	}
+	tw := tar.NewWriter(f)
+	err = addBundleEntry(tw, BUNDLE_MANIFEST, int64(len(manifestData)), bytes.NewReader(manifestData))
+	if err == nil {
+		err = addBundleEntry(tw, BUNDLE_IMAGES, size, saved)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("error writing bundle %s: %v", path, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"path":   path,
+		"images": len(images),
+		"size":   size,
+	}).Debug("Exported image bundle")
+	return manifest, nil
+}
+
+// ImportImageBundle loads the images of a bundle written by ExportImageBundle and returns its manifest.
+// It fails if an image listed in the manifest is missing afterwards.
+func ImportImageBundle(cli *client.Client, ctx context.Context, path string) (*BundleManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening bundle: %v", err)
+	}
+	defer f.Close()
+
+	var manifest *BundleManifest
+	loaded := false
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading bundle %s: %v", path, err)
+		}
+		switch hdr.Name {
+		case BUNDLE_MANIFEST:
+			manifest = &BundleManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("error parsing bundle manifest: %v", err)
+			}
+		case BUNDLE_IMAGES:
+			log.WithField("path", path).Debug("Loading images")
+			resp, err := cli.ImageLoad(ctx, tr, true)
+			if err != nil {
+				return nil, fmt.Errorf("error loading images: %v", err)
+			}
+			err = streamDockerOutput(resp.Body, io.Discard)
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error loading images: %v", err)
+			}
+			loaded = true
+		default:
+			log.WithField("entry", hdr.Name).Warn("Skipping unknown bundle entry")
+		}
+	}
+	if manifest == nil || !loaded {
+		return nil, fmt.Errorf("%s is not an image bundle, it lacks %s or %s", path, BUNDLE_MANIFEST, BUNDLE_IMAGES)
+	}
+
+	for _, img := range manifest.Images {
+		if _, _, err := cli.ImageInspectWithRaw(ctx, img.Image); err != nil {
+			return manifest, fmt.Errorf("image %s is missing after loading the bundle: %v", img.Image, err)
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,157 @@
+package docker_control
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// SHARED_DIR is where every router container has the testnet's shared volume mounted
+const SHARED_DIR = "/shared"
+
+// RouterContainer describes a router container to create
+type RouterContainer struct {
+	Name  string
+	Kind  string
+	Image string
+	IP    string
+	// IPv6 is the router's address on a dual-stack network, empty on an IPv4-only one
+	IPv6 string
+	// VolumeName is the router's data volume, mounted at DataDir
+	VolumeName string
+	DataDir    string
+	// Files are written into DataDir before the router starts, keyed by their path relative to it
+	Files      map[string][]byte
+	Cmd        []string
+	Env        []string
+	User       string
+	StopSignal string
+	// StopTimeout is how many seconds a graceful shutdown may take, 0 leaves Docker's default
+	StopTimeout int
+	// Network is the network the container is attached to, the testnet's network if empty
+	Network string
+	// Ports are published on auto-assigned ports of the host's loopback interface, through the testnet's publish network
+	Ports []int
+}
+
+// CreateRouterContainer creates a router container on the testnet's network, with its data volume and the shared volume
+// mounted, writes its files into the data dir and starts it. The router's command waits for OpenGate, on this and
+// every later start, so its network can be set up first. The container is removed again if it can't be set up.
+func CreateRouterContainer(cli *client.Client, ctx context.Context, ref TestnetRef, rc RouterContainer) (string, error) {
+	networkName := ref.NetworkName()
+	if rc.Network != "" {
+		networkName = rc.Network
+	}
+	log.WithFields(map[string]interface{}{
+		"containerName": rc.Name,
+		"kind":          rc.Kind,
+		"image":         rc.Image,
+		"ip":            rc.IP,
+		"ipv6":          rc.IPv6,
+		"networkName":   networkName,
+		"volumeName":    rc.VolumeName,
+	}).Debug("Starting router container creation")
+
+	entrypoint, cmd, err := gatedCommand(cli, ctx, rc.Image, rc.Cmd)
+	if err != nil {
+		return "", err
+	}
+	containerConfig := &container.Config{
+		Image:      rc.Image,
+		Entrypoint: entrypoint,
+		Cmd:        cmd,
+		Env:        rc.Env,
+		User:       rc.User,
+		Labels:     ref.RouterLabels(ROLE_ROUTER, rc.Kind),
+		StopSignal: rc.StopSignal,
+	}
+	if rc.StopTimeout > 0 {
+		stopTimeout := rc.StopTimeout
+		containerConfig.StopTimeout = &stopTimeout
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:%s", rc.VolumeName, rc.DataDir),
+			fmt.Sprintf("%s:%s", ref.SharedVolume(), SHARED_DIR),
+		},
+		// Writable for whatever user the router runs as
+		Tmpfs: map[string]string{GATE_DIR: "mode=1777"},
+	}
+	if len(rc.Ports) > 0 {
+		containerConfig.ExposedPorts, hostConfig.PortBindings = portBindings(rc.Ports)
+	}
+
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {
+				IPAMConfig: &network.EndpointIPAMConfig{
+					IPv4Address: rc.IP,
+					IPv6Address: rc.IPv6,
+				},
+			},
+		},
+	}
+
+	resp, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, rc.Name)
+	if err != nil {
+		log.WithFields(map[string]interface{}{
+			"containerName": rc.Name,
+			"error":         err,
+		}).Error("Failed to create router container")
+		return "", fmt.Errorf("error creating container: %v", err)
+	}
+
+	removeContainer := func() {
+		if err := cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			log.WithError(err).Error("Failed to remove router container after failed setup")
+		}
+	}
+
+	if err := checkShell(cli, ctx, resp.ID, rc.Image); err != nil {
+		removeContainer()
+		return "", err
+	}
+
+	// Ports can only be published through a network that isn't internal
+	if len(rc.Ports) > 0 {
+		if err := cli.NetworkConnect(ctx, ref.PublishNetwork(), resp.ID, nil); err != nil {
+			log.WithFields(map[string]interface{}{
+				"containerID": resp.ID,
+				"error":       err,
+			}).Error("Failed to connect router container to the publish network")
+			removeContainer()
+			return "", fmt.Errorf("error connecting container to %s: %v", ref.PublishNetwork(), err)
+		}
+	}
+
+	// The data volume is mounted for the archive API before the container first runs
+	if len(rc.Files) > 0 {
+		if err := ContainerFS(cli, resp.ID, rc.DataDir).WriteFiles(ctx, rc.Files); err != nil {
+			log.WithFields(map[string]interface{}{
+				"containerID": resp.ID,
+				"error":       err,
+			}).Error("Failed to write files to router container")
+			removeContainer()
+			return "", fmt.Errorf("error writing router files: %v", err)
+		}
+	}
+
+	log.WithField("containerID", resp.ID).Debug("Starting router container")
+	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		log.WithFields(map[string]interface{}{
+			"containerID": resp.ID,
+			"error":       err,
+		}).Error("Failed to start router container")
+		removeContainer()
+		return "", fmt.Errorf("error starting container: %v", err)
+	}
+
+	log.WithFields(map[string]interface{}{
+		"containerID":   resp.ID,
+		"containerName": rc.Name,
+	}).Debug("Successfully created and started router container")
+	return resp.ID, nil
+}
@@ -0,0 +1,150 @@
+package docker_control
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// dockerignore holds the patterns of a build context's .dockerignore, "!" patterns re-include files
+type dockerignore []string
+
+// readDockerignore reads the .dockerignore in dir, if there is one
+func readDockerignore(dir string) (dockerignore, error) {
+	f, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns dockerignore
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		line = path.Clean(strings.TrimPrefix(strings.TrimPrefix(line, "!"), "/"))
+		if negate {
+			line = "!" + line
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// ignored reports whether the slash separated path name, relative to the build context, is left out of it.
+// A pattern matching one of its parent directories matches the file too; the last matching pattern wins.
+func (d dockerignore) ignored(name string) bool {
+	ignored := false
+	for _, pattern := range d {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		for p := name; p != "."; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				ignored = !negate
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// BuildDockerImageFromDir builds imageName from a Dockerfile on the host, with the directory holding it as
+// the build context. Files matched by the directory's .dockerignore are left out. The build is skipped if
+// the image was built from the same files.
+func BuildDockerImageFromDir(cli *client.Client, ctx context.Context, imageName string, dockerfilePath string, buildArgs map[string]*string, labels map[string]string) error {
+	dir := filepath.Dir(dockerfilePath)
+	log.WithFields(map[string]interface{}{
+		"imageName":  imageName,
+		"dockerfile": dockerfilePath,
+		"buildArgs":  len(buildArgs),
+	}).Debug("Starting Docker image build from directory")
+
+	if _, err := os.Stat(dockerfilePath); err != nil {
+		return fmt.Errorf("error reading Dockerfile: %v", err)
+	}
+	ignore, err := readDockerignore(dir)
+	if err != nil {
+		return fmt.Errorf("error reading .dockerignore of %s: %v", dir, err)
+	}
+	dockerfile := filepath.Base(dockerfilePath)
+
+	tarBuffer := new(bytes.Buffer)
+	tw := tar.NewWriter(tarBuffer)
+	files := 0
+	err = filepath.WalkDir(dir, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fullPath)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		// The Dockerfile is always sent, the daemon needs it even if it is ignored
+		if name != dockerfile && ignore.ignored(name) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		files++
+		return addContextFile(tw, dir, name, name)
+	})
+	if err != nil {
+		tw.Close()
+		log.WithError(err).Error("Failed to create build context")
+		return fmt.Errorf("error creating build context from %s: %v", dir, err)
+	}
+	if err := tw.Close(); err != nil {
+		log.WithError(err).Error("Failed to close tar writer")
+		return fmt.Errorf("error closing tar writer: %v", err)
+	}
+	log.WithField("files", files).Debug("Created build context")
+
+	return buildIfStale(cli, ctx, imageName, tarBuffer, dockerfile, buildArgs, labels)
+}
+
+// PullDockerImage pulls imageName from its registry, unless it already exists
+func PullDockerImage(cli *client.Client, ctx context.Context, imageName string) error {
+	exists, err := imageExists(cli, ctx, imageName)
+	if err != nil {
+		log.WithError(err).Error("Failed to check if Docker image exists")
+		return fmt.Errorf("error checking for Docker image: %v", err)
+	}
+	if exists {
+		log.WithField("imageName", imageName).Debug("Docker image already exists, skipping pull")
+		return nil
+	}
+
+	log.WithField("imageName", imageName).Info("Pulling Docker image")
+	reader, err := cli.ImagePull(ctx, imageName, image.PullOptions{})
+	if err != nil {
+		log.WithError(err).Error("Failed to pull Docker image")
+		return fmt.Errorf("error pulling image %s: %v", imageName, err)
+	}
+	defer reader.Close()
+	// The pull only completes once its progress stream has been read to the end
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return fmt.Errorf("error pulling image %s: %v", imageName, err)
+	}
+	return nil
+}
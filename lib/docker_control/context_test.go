@@ -0,0 +1,133 @@
+package docker_control
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadDockerignore(t *testing.T) {
+	dir := t.TempDir()
+	if d, err := readDockerignore(dir); d != nil || err != nil {
+		t.Fatalf("readDockerignore() without a file = %q, %v, want nothing", d, err)
+	}
+
+	content := "# build output\n\n/bin/\n  *.log  \n!keep.log\n./docs/../tmp\n!/vendor/\n"
+	if err := os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := readDockerignore(dir)
+	if err != nil {
+		t.Fatalf("readDockerignore() = %v", err)
+	}
+	want := dockerignore{"bin", "*.log", "!keep.log", "tmp", "!vendor"}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("readDockerignore() = %q, want %q", d, want)
+	}
+}
+
+func TestDockerignoreIgnored(t *testing.T) {
+	d := dockerignore{"bin", "*.log", "!keep.log", "docs/*.md", "!docs/README.md", "vendor", "!vendor/keep"}
+	tests := []struct {
+		name    string
+		ignored bool
+	}{
+		{"main.go", false},
+		{"bin", true},
+		{"bin/router", true},
+		{"cmd/bin", false},
+		{"build.log", true},
+		{"keep.log", false},
+		{"logs/build.log", false},
+		{"docs/guide.md", true},
+		{"docs/README.md", false},
+		{"docs/img/logo.png", false},
+		{"vendor/a/b.go", true},
+		{"vendor/keep", false},
+		{"vendor/keep/a.go", false},
+	}
+	for _, tt := range tests {
+		if got := d.ignored(tt.name); got != tt.ignored {
+			t.Errorf("ignored(%q) = %v, want %v", tt.name, got, tt.ignored)
+		}
+	}
+	if (dockerignore(nil)).ignored("anything") {
+		t.Errorf("an empty .dockerignore ignores files")
+	}
+}
+
+// contextFile is a file in a test build context
+type contextFile struct {
+	name    string
+	mode    int64
+	content string
+}
+
+// buildContext returns a tar archive of files, all modified at modTime
+func buildContext(t *testing.T, modTime time.Time, files ...contextFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: f.mode, Size: int64(len(f.content)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestContextHash(t *testing.T) {
+	now := time.Now()
+	files := []contextFile{{"Dockerfile", 0644, "FROM alpine\n"}, {"entrypoint.sh", 0755, "#!/bin/sh\n"}}
+	version := "2.54.0"
+	args := map[string]*string{"I2PD_VERSION": &version, "UNSET": nil}
+
+	hash := func(context []byte, dockerfile string, args map[string]*string) string {
+		t.Helper()
+		h, err := contextHash(context, dockerfile, args)
+		if err != nil {
+			t.Fatalf("contextHash() = %v", err)
+		}
+		return h
+	}
+	base := hash(buildContext(t, now, files...), "Dockerfile", args)
+
+	// Copying the same files again, or passing the same arguments in a new map, doesn't change the hash
+	otherVersion := "2.54.0"
+	if got := hash(buildContext(t, now.Add(time.Hour), files...), "Dockerfile", map[string]*string{"UNSET": nil, "I2PD_VERSION": &otherVersion}); got != base {
+		t.Errorf("contextHash() changed with only the modification times")
+	}
+
+	newer := "2.55.0"
+	empty := ""
+	changes := map[string]string{
+		"content":       hash(buildContext(t, now, contextFile{"Dockerfile", 0644, "FROM debian\n"}, files[1]), "Dockerfile", args),
+		"mode":          hash(buildContext(t, now, files[0], contextFile{"entrypoint.sh", 0644, "#!/bin/sh\n"}), "Dockerfile", args),
+		"name":          hash(buildContext(t, now, files[0], contextFile{"start.sh", 0755, "#!/bin/sh\n"}), "Dockerfile", args),
+		"missing file":  hash(buildContext(t, now, files[0]), "Dockerfile", args),
+		"dockerfile":    hash(buildContext(t, now, files...), "other.dockerfile", args),
+		"argument":      hash(buildContext(t, now, files...), "Dockerfile", map[string]*string{"I2PD_VERSION": &newer, "UNSET": nil}),
+		"unset to set":  hash(buildContext(t, now, files...), "Dockerfile", map[string]*string{"I2PD_VERSION": &version, "UNSET": &empty}),
+		"argument gone": hash(buildContext(t, now, files...), "Dockerfile", map[string]*string{"I2PD_VERSION": &version}),
+	}
+	for change, got := range changes {
+		if got == base {
+			t.Errorf("contextHash() didn't change with the %s", change)
+		}
+	}
+
+	if _, err := contextHash([]byte("not a tar archive, but long enough to be read as a header block"), "Dockerfile", nil); err == nil {
+		t.Errorf("contextHash() accepted a broken build context")
+	}
+}
@@ -0,0 +1,42 @@
+package docker_control
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ExecInContainer runs cmd inside a running container and returns its exit code and combined output
+func ExecInContainer(cli *client.Client, ctx context.Context, containerID string, cmd []string) (int, string, error) {
+	log.WithFields(map[string]interface{}{
+		"containerID": containerID,
+		"cmd":         cmd,
+	}).Debug("Running command in container")
+
+	exec, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("error creating exec in container %s: %v", containerID, err)
+	}
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return 0, "", fmt.Errorf("error attaching to exec in container %s: %v", containerID, err)
+	}
+	defer resp.Close()
+
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, resp.Reader); err != nil {
+		return 0, "", fmt.Errorf("error reading exec output from container %s: %v", containerID, err)
+	}
+	inspect, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, "", fmt.Errorf("error inspecting exec in container %s: %v", containerID, err)
+	}
+	return inspect.ExitCode, out.String(), nil
+}
@@ -0,0 +1,31 @@
+package docker_control
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+)
+
+// familyScript removes the global addresses of one address family from every interface but loopback.
+// It is run as `sh -c familyScript sh <-4|-6>`.
+const familyScript = `for dev in $(ls /sys/class/net); do
+	[ "$dev" = lo ] && continue
+	ip "$1" addr flush dev "$dev" scope global || exit 1
+done`
+
+// DropAddressFamily removes the IPv4 or IPv6 addresses of a running router container, so it can only use the other
+// family. Docker attaches every container of a dual-stack network with both, and gives them back on every start.
+func DropAddressFamily(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, ipv6 bool) error {
+	family := "-4"
+	if ipv6 {
+		family = "-6"
+	}
+	if _, err := RunSidecar(cli, ctx, ref, containerID, NETEM_IMAGE, []string{"sh", "-c", familyScript, "sh", family}); err != nil {
+		return fmt.Errorf("error removing the %s addresses of %s: %v", family, containerID, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"containerID": containerID,
+		"family":      family,
+	}).Debug("Removed addresses of an address family")
+	return nil
+}
@@ -0,0 +1,87 @@
+package docker_control
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"strings"
+)
+
+const (
+	// GATE_DIR is a tmpfs in every router container, so the gate is closed again whenever the container starts
+	GATE_DIR = "/run/testnet"
+	// GATE_FILE lets the router's command run once it exists
+	GATE_FILE = GATE_DIR + "/network-ready"
+	// GATE_TIMEOUT is how many seconds a router's command waits for the gate before it runs anyway, e.g. after a
+	// `docker restart` or a restart of the Docker daemon, which the testnet doesn't notice
+	GATE_TIMEOUT = 120
+)
+
+// gateScript holds a router's command back until GATE_FILE exists, then runs it in its place. The testnet can only
+// set up a container's network namespace once the container runs, as sidecars join the namespace of a running
+// container, so the router waits for that instead of sending its first packets unimpaired. It only needs sleep besides
+// the shell, and after GATE_TIMEOUT it says so in the router's log and runs the command without the network set up.
+// It is run as `sh -c gateScript sh <command...>`.
+var gateScript = fmt.Sprintf(`trap 'exit 0' TERM INT
+if ! command -v sleep >/dev/null 2>&1; then
+	echo "testnet: the image has no sleep, which the router needs to wait for its network to be set up" >&2
+	exit 127
+fi
+waited=0
+while [ ! -e %[1]s ]; do
+	if [ "$waited" -ge %[2]d ]; then
+		echo "testnet: the network wasn't set up within %[3]d seconds, running the router without it; use restart or start-node to set it up" >&2
+		break
+	fi
+	if sleep 0.1 2>/dev/null; then waited=$((waited + 1)); else sleep 1; waited=$((waited + 10)); fi
+done
+exec "$@"`, GATE_FILE, GATE_TIMEOUT*10, GATE_TIMEOUT)
+
+// gatedCommand returns the entrypoint and command that run a router's command behind the gate. The command is
+// cmd, or the image's if cmd is empty, after the image's entrypoint.
+func gatedCommand(cli *client.Client, ctx context.Context, image string, cmd []string) ([]string, []string, error) {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error inspecting image %s: %v", image, err)
+	}
+	var command []string
+	if inspect.Config != nil {
+		command = append(command, inspect.Config.Entrypoint...)
+		if len(cmd) == 0 {
+			cmd = inspect.Config.Cmd
+		}
+	}
+	command = append(command, cmd...)
+	if len(command) == 0 {
+		return nil, nil, fmt.Errorf("image %s has no command and none was given", image)
+	}
+	return []string{"/bin/sh", "-c", gateScript, "sh"}, command, nil
+}
+
+// checkShell fails if a created router container has no /bin/sh to run the gate with
+func checkShell(cli *client.Client, ctx context.Context, containerID string, image string) error {
+	if _, err := cli.ContainerStatPath(ctx, containerID, "/bin/sh"); err != nil {
+		if client.IsErrNotFound(err) {
+			return fmt.Errorf("image %s has no /bin/sh, which the testnet needs to hold the router back until its network is set up", image)
+		}
+		return fmt.Errorf("error looking for /bin/sh in image %s: %v", image, err)
+	}
+	return nil
+}
+
+// OpenGate lets the command of a running router container start, once its network is set up
+func OpenGate(cli *client.Client, ctx context.Context, containerID string) error {
+	code, out, err := ExecInContainer(cli, ctx, containerID, []string{"/bin/sh", "-c", ": > " + GATE_FILE})
+	if err == nil && code == 0 {
+		log.WithField("containerID", containerID).Debug("Opened router gate")
+		return nil
+	}
+	// A container that exited, e.g. because its image has no sleep, can't be exec'd into
+	if inspect, ierr := cli.ContainerInspect(ctx, containerID); ierr == nil && inspect.State != nil && !inspect.State.Running {
+		return fmt.Errorf("error opening the gate of %s: the container exited with status %d, see its logs", containerID, inspect.State.ExitCode)
+	}
+	if err != nil {
+		return fmt.Errorf("error opening the gate of %s: %v", containerID, err)
+	}
+	return fmt.Errorf("error opening the gate of %s: %s", containerID, strings.TrimSpace(out))
+}
@@ -6,13 +6,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 	"go-i2p-testnet/lib/dockerfiles"
 	"go-i2p-testnet/lib/utils/logger"
 	"io"
+	"sort"
 	"strings"
 )
 
@@ -27,25 +30,34 @@ type DockerMessage struct {
 	Error string `json:"error,omitempty"`
 }
 
+// BuildDockerImage builds imageName from an embedded Dockerfile, unless an image built from the same Dockerfile exists
 func BuildDockerImage(cli *client.Client, ctx context.Context, imageName string, dockerfileName string) error {
+	return buildEmbeddedImage(cli, ctx, imageName, dockerfileName, nil, nil)
+}
+
+// BuildNodeImage builds the image of a node type at a version, unless an up to date image exists.
+// The version is passed to the Dockerfile in the node type's VersionArg and recorded in the LABEL_VERSION label.
+func BuildNodeImage(cli *client.Client, ctx context.Context, node NodeType, version string) error {
+	version = NormalizeVersion(version)
+	var buildArgs map[string]*string
+	if version != VERSION_LATEST {
+		if node.VersionArg == "" {
+			return fmt.Errorf("%s images can't be built at a version", node.ImageName)
+		}
+		buildArgs = map[string]*string{node.VersionArg: &version}
+	}
+	labels := map[string]string{LABEL_VERSION: version}
+	return buildEmbeddedImage(cli, ctx, node.Image(version), node.Dockerfile(version), buildArgs, labels)
+}
+
+// buildEmbeddedImage builds imageName from an embedded Dockerfile, unless an image built from the same Dockerfile exists
+func buildEmbeddedImage(cli *client.Client, ctx context.Context, imageName string, dockerfileName string, buildArgs map[string]*string, labels map[string]string) error {
 	log.WithFields(map[string]interface{}{
 		"imageName":      imageName,
 		"dockerfileName": dockerfileName,
+		"buildArgs":      len(buildArgs),
 	}).Debug("Starting Docker image build")
 
-	// Check if the image already exists
-	exists, err := imageExists(cli, ctx, imageName)
-	if err != nil {
-		log.WithError(err).Error("Failed to check if Docker image exists")
-		return fmt.Errorf("error checking for Docker image: %v", err)
-	}
-
-	// If the image exists, skip building it
-	if exists {
-		log.WithField("imageName", imageName).Debug("Docker image already exists, skipping build")
-		return nil
-	}
-
 	// Retrieve the Dockerfile content from the embedded files
 	dockerfileContent, err := dockerfiles.GetDockerfileContent(dockerfileName)
 	if err != nil {
@@ -57,54 +69,81 @@ func BuildDockerImage(cli *client.Client, ctx context.Context, imageName string,
 	log.Debug("Creating in-memory tar archive of embedded Dockerfile")
 	tarBuffer := new(bytes.Buffer)
 	tw := tar.NewWriter(tarBuffer)
+	if err := writeDockerfile(tw, dockerfileContent); err != nil {
+		tw.Close()
+		return err
+	}
 
-	// Add the Dockerfile to the tar archive
-	err = tw.WriteHeader(&tar.Header{
+	// Close the tar writer
+	err = tw.Close()
+	if err != nil {
+		log.WithError(err).Error("Failed to close tar writer")
+		return fmt.Errorf("error closing tar writer: %v", err)
+	}
+
+	return buildIfStale(cli, ctx, imageName, tarBuffer, "Dockerfile", buildArgs, labels)
+}
+
+// writeDockerfile adds the Dockerfile to a build context
+func writeDockerfile(tw *tar.Writer, dockerfileContent []byte) error {
+	err := tw.WriteHeader(&tar.Header{
 		Name: "Dockerfile",
 		Size: int64(len(dockerfileContent)),
 		Mode: 0600,
 	})
 	if err != nil {
-		tw.Close()
 		log.WithError(err).Error("Failed to write tar header")
 		return fmt.Errorf("error writing tar header: %v", err)
 	}
 
 	_, err = tw.Write(dockerfileContent)
 	if err != nil {
-		tw.Close()
 		log.WithError(err).Error("Failed to write Dockerfile to tar")
 		return fmt.Errorf("error writing Dockerfile to tar: %v", err)
 	}
+	return nil
+}
 
-	// Close the tar writer
-	err = tw.Close()
+// runImageBuild builds an image from a build context holding the named Dockerfile and tags it with every tag.
+// The build output is saved to a file in BuildLogDir, and an error reported by the build fails it.
+func runImageBuild(cli *client.Client, ctx context.Context, buildContext io.Reader, dockerfile string, tags []string, buildArgs map[string]*string, labels map[string]string) error {
+	buildLog, err := createBuildLog(tags[0])
 	if err != nil {
-		log.WithError(err).Error("Failed to close tar writer")
-		return fmt.Errorf("error closing tar writer: %v", err)
+		log.WithError(err).Error("Failed to create build log")
+		return err
 	}
+	defer buildLog.Close()
 
 	// Use the in-memory tar archive as the build context
-	log.Debug("Initiating Docker image build")
+	log.WithFields(map[string]interface{}{
+		"tags":     tags,
+		"buildLog": buildLog.Name(),
+	}).Debug("Initiating Docker image build")
 	buildOptions := types.ImageBuildOptions{
-		Tags:       []string{imageName},
-		Dockerfile: "Dockerfile",
+		Tags:       tags,
+		Dockerfile: dockerfile,
 		Remove:     true,
+		BuildArgs:  buildArgs,
+		Labels:     labels,
 	}
 
-	resp, err := cli.ImageBuild(ctx, tarBuffer, buildOptions)
+	resp, err := cli.ImageBuild(ctx, buildContext, buildOptions)
 	if err != nil {
 		log.WithError(err).Error("Docker image build failed")
 		return fmt.Errorf("error building Docker image: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if err := streamDockerOutput(resp.Body); err != nil {
-		log.WithError(err).Error("Failed to read build output")
-		return fmt.Errorf("error reading build output: %v", err)
+	if err := streamDockerOutput(resp.Body, buildLog); err != nil {
+		log.WithFields(map[string]interface{}{
+			"image":    tags[0],
+			"buildLog": buildLog.Name(),
+			"error":    err,
+		}).Error("Docker image build failed")
+		return fmt.Errorf("error building image %s: %v (full build log in %s)", tags[0], err, buildLog.Name())
 	}
 
-	log.Debug("Docker build completed")
+	log.WithField("buildLog", buildLog.Name()).Debug("Docker build completed")
 	return nil
 }
 
@@ -139,6 +178,41 @@ func RemoveDockerImage(cli *client.Client, ctx context.Context, imageName string
 	}
 	return nil
 }
+
+// ImageTags returns the tags of the local images of a repository, e.g. every version of "i2pd-node"
+func ImageTags(cli *client.Client, ctx context.Context, repository string) ([]string, error) {
+	images, err := cli.ImageList(ctx, image.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", repository)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing images of %s: %v", repository, err)
+	}
+	var tags []string
+	for _, img := range images {
+		tags = append(tags, img.RepoTags...)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// RemoveRepositoryImages removes every local tag of a repository, e.g. every version of "i2pd-node"
+func RemoveRepositoryImages(cli *client.Client, ctx context.Context, repository string) error {
+	tags, err := ImageTags(cli, ctx, repository)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		log.WithField("repository", repository).Error("Cannot remove images of a repository without images")
+		return fmt.Errorf("error: cant remove images of '%s', there are none", repository)
+	}
+	for _, tag := range tags {
+		if err := RemoveDockerImage(cli, ctx, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func imageExists(cli *client.Client, ctx context.Context, imageName string) (bool, error) {
 	log.WithField("imageName", imageName).Debug("Checking if Docker image exists")
 
@@ -162,9 +236,13 @@ func imageExists(cli *client.Client, ctx context.Context, imageName string) (boo
 	return false, nil
 }
 
-// streamDockerOutput reads the Docker build output and prints it in a clean format
-func streamDockerOutput(reader io.Reader) error {
+// streamDockerOutput prints the Docker build output in a clean format and copies all of it to buildLog.
+// It returns the error the build reported, if any.
+func streamDockerOutput(reader io.Reader, buildLog io.Writer) error {
 	scanner := bufio.NewScanner(reader)
+	// Some build steps print very long lines
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var buildErr error
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -173,6 +251,7 @@ func streamDockerOutput(reader io.Reader) error {
 		if err := json.Unmarshal([]byte(line), &msg); err != nil {
 			// If it's not JSON, print the line as-is
 			fmt.Println(line)
+			fmt.Fprintln(buildLog, line)
 			continue
 		}
 
@@ -180,9 +259,16 @@ func streamDockerOutput(reader io.Reader) error {
 		switch {
 		case msg.Error != "":
 			log.Errorf("Docker build error: %s", msg.Error)
+			fmt.Fprintln(buildLog, "ERROR: "+msg.Error)
+			if buildErr == nil {
+				buildErr = errors.New(msg.Error)
+			}
 		case msg.Aux.ID != "":
 			log.Infof("Image ID: %s", msg.Aux.ID)
+			fmt.Fprintln(buildLog, "Image ID: "+msg.Aux.ID)
 		case msg.Stream != "":
+			// The log keeps the output as it came, including the progress of each step
+			fmt.Fprint(buildLog, msg.Stream)
 			// Clean up the stream output
 			stream := strings.TrimSpace(msg.Stream)
 			if stream != "" {
@@ -198,5 +284,5 @@ func streamDockerOutput(reader io.Reader) error {
 		return fmt.Errorf("error reading docker output: %v", err)
 	}
 
-	return nil
+	return buildErr
 }
@@ -0,0 +1,122 @@
+package docker_control
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// IPAM hands out the addresses of a subnet to the containers of a testnet. Addresses are handed out in order
+// across the whole subnet and released addresses are reused only after the end of the subnet was reached,
+// so a new router rarely gets the address a removed router's peers still remember.
+// An IPAM is not safe for concurrent use.
+type IPAM struct {
+	prefix netip.Prefix
+	// allocated maps every handed out address to the container it belongs to
+	allocated map[netip.Addr]string
+	// last is the address handed out most recently, the search for a free one continues after it
+	last netip.Addr
+}
+
+// ParseSubnet parses a subnet in CIDR notation, such as 172.28.0.0/16, as used for a testnet network
+func ParseSubnet(subnet string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid subnet %q: %v", subnet, err)
+	}
+	if prefix != prefix.Masked() {
+		return netip.Prefix{}, fmt.Errorf("invalid subnet %q, the address has host bits set, use %s", subnet, prefix.Masked())
+	}
+	// Network address, gateway and, for IPv4, broadcast address leave at least one address for a router
+	if prefix.Addr().BitLen()-prefix.Bits() < 2 {
+		return netip.Prefix{}, fmt.Errorf("subnet %s is too small for a testnet", subnet)
+	}
+	return prefix, nil
+}
+
+// NewIPAM returns an allocator for subnet that knows the given addresses, keyed by address, are in use.
+// Addresses of the other address family are left out, so one map can hold the allocations of a dual-stack network.
+func NewIPAM(subnet string, allocated map[string]string, last string) (*IPAM, error) {
+	prefix, err := ParseSubnet(subnet)
+	if err != nil {
+		return nil, err
+	}
+	ipam := &IPAM{prefix: prefix, allocated: map[netip.Addr]string{}}
+	for addr, owner := range allocated {
+		ip, err := netip.ParseAddr(addr)
+		if err == nil && ip.Is4() != prefix.Addr().Is4() {
+			continue
+		}
+		if err != nil || !prefix.Contains(ip) {
+			return nil, fmt.Errorf("allocated address %q of %s is not in subnet %s", addr, owner, subnet)
+		}
+		ipam.allocated[ip] = owner
+	}
+	if ip, err := netip.ParseAddr(last); err == nil && prefix.Contains(ip) {
+		ipam.last = ip
+	}
+	return ipam, nil
+}
+
+// Subnet returns the subnet addresses are handed out from
+func (a *IPAM) Subnet() string {
+	return a.prefix.String()
+}
+
+// first returns the first address for containers, after the network address and the gateway Docker assigns
+func (a *IPAM) first() netip.Addr {
+	return a.prefix.Addr().Next().Next()
+}
+
+// usable reports whether an address may be handed out: it is in the subnet and isn't the IPv4 broadcast address
+func (a *IPAM) usable(ip netip.Addr) bool {
+	if !ip.IsValid() || !a.prefix.Contains(ip) || ip.Less(a.first()) {
+		return false
+	}
+	return !a.prefix.Addr().Is4() || a.prefix.Contains(ip.Next())
+}
+
+// Allocate hands out the next free address to owner
+func (a *IPAM) Allocate(owner string) (string, error) {
+	start := a.first()
+	if a.usable(a.last) && a.usable(a.last.Next()) {
+		start = a.last.Next()
+	}
+	ip := start
+	for {
+		if _, taken := a.allocated[ip]; !taken {
+			a.allocated[ip] = owner
+			a.last = ip
+			return ip.String(), nil
+		}
+		if ip = ip.Next(); !a.usable(ip) {
+			ip = a.first()
+		}
+		if ip == start {
+			return "", fmt.Errorf("no free address left in subnet %s, all %d are in use", a.prefix, len(a.allocated))
+		}
+	}
+}
+
+// Release returns an address to the free pool, releasing an address that isn't allocated does nothing
+func (a *IPAM) Release(addr string) {
+	if ip, err := netip.ParseAddr(addr); err == nil {
+		delete(a.allocated, ip)
+	}
+}
+
+// Allocations returns the handed out addresses with their owners
+func (a *IPAM) Allocations() map[string]string {
+	allocations := make(map[string]string, len(a.allocated))
+	for ip, owner := range a.allocated {
+		allocations[ip.String()] = owner
+	}
+	return allocations
+}
+
+// Last returns the address handed out most recently, empty if none was
+func (a *IPAM) Last() string {
+	if !a.last.IsValid() {
+		return ""
+	}
+	return a.last.String()
+}
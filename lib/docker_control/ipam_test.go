@@ -0,0 +1,176 @@
+package docker_control
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSubnet(t *testing.T) {
+	tests := []struct {
+		subnet string
+		err    string
+	}{
+		{"172.28.0.0/16", ""},
+		{"10.0.0.0/30", ""},
+		{"fd00:1:2:3::/64", ""},
+		{"172.28.0.1/16", "host bits set"},
+		{"10.0.0.0/31", "too small"},
+		{"10.0.0.0/32", "too small"},
+		{"fd00::/127", "too small"},
+		{"172.28.0.0", "invalid subnet"},
+		{"not-a-subnet", "invalid subnet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subnet, func(t *testing.T) {
+			_, err := ParseSubnet(tt.subnet)
+			if tt.err == "" && err != nil {
+				t.Errorf("ParseSubnet(%q) = %v, want no error", tt.subnet, err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("ParseSubnet(%q) = %v, want an error containing %q", tt.subnet, err, tt.err)
+			}
+		})
+	}
+}
+
+// ipamStep allocates an address for owner, or releases addr if release is set
+type ipamStep struct {
+	owner   string
+	release string
+	want    string
+	full    bool
+}
+
+func TestIPAMAllocate(t *testing.T) {
+	tests := []struct {
+		name      string
+		subnet    string
+		allocated map[string]string
+		last      string
+		steps     []ipamStep
+	}{
+		{
+			name:   "in order, skipping network, gateway and broadcast",
+			subnet: "10.0.0.0/29",
+			steps: []ipamStep{
+				{owner: "a", want: "10.0.0.2"},
+				{owner: "b", want: "10.0.0.3"},
+				{owner: "c", want: "10.0.0.4"},
+				{owner: "d", want: "10.0.0.5"},
+				{owner: "e", want: "10.0.0.6"},
+				{owner: "f", full: true},
+			},
+		},
+		{
+			name:   "released addresses are reused after the end of the subnet",
+			subnet: "10.0.0.0/29",
+			steps: []ipamStep{
+				{owner: "a", want: "10.0.0.2"},
+				{owner: "b", want: "10.0.0.3"},
+				{release: "10.0.0.2"},
+				{owner: "c", want: "10.0.0.4"},
+				{owner: "d", want: "10.0.0.5"},
+				{owner: "e", want: "10.0.0.6"},
+				{owner: "f", want: "10.0.0.2"},
+				{owner: "g", full: true},
+				{release: "10.0.0.4"},
+				{owner: "h", want: "10.0.0.4"},
+			},
+		},
+		{
+			name:      "restored from state",
+			subnet:    "172.28.0.0/16",
+			allocated: map[string]string{"172.28.0.2": "a", "172.28.0.3": "b", "172.28.0.9": "c"},
+			last:      "172.28.0.8",
+			steps: []ipamStep{
+				{owner: "d", want: "172.28.0.10"},
+				{owner: "e", want: "172.28.0.11"},
+			},
+		},
+		{
+			name:      "last address outside the subnet starts over",
+			subnet:    "172.28.0.0/16",
+			allocated: map[string]string{"172.28.0.2": "a"},
+			last:      "10.0.0.7",
+			steps:     []ipamStep{{owner: "b", want: "172.28.0.3"}},
+		},
+		{
+			name:      "addresses of the other family are left out",
+			subnet:    "172.28.0.0/16",
+			allocated: map[string]string{"172.28.0.2": "a", "fd00::2": "a"},
+			steps:     []ipamStep{{owner: "b", want: "172.28.0.3"}},
+		},
+		{
+			name:   "IPv6 has no broadcast address",
+			subnet: "fd00::/126",
+			steps: []ipamStep{
+				{owner: "a", want: "fd00::2"},
+				{owner: "b", want: "fd00::3"},
+				{owner: "c", full: true},
+			},
+		},
+		{
+			name:   "releasing an unknown address does nothing",
+			subnet: "10.0.0.0/30",
+			steps: []ipamStep{
+				{release: "10.0.0.9"},
+				{release: "garbage"},
+				{owner: "a", want: "10.0.0.2"},
+				{owner: "b", full: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipam, err := NewIPAM(tt.subnet, tt.allocated, tt.last)
+			if err != nil {
+				t.Fatalf("NewIPAM() = %v", err)
+			}
+			for i, step := range tt.steps {
+				if step.release != "" {
+					ipam.Release(step.release)
+					continue
+				}
+				got, err := ipam.Allocate(step.owner)
+				switch {
+				case step.full && err == nil:
+					t.Fatalf("step %d: Allocate() = %s, want an error for a full subnet", i, got)
+				case !step.full && err != nil:
+					t.Fatalf("step %d: Allocate() = %v", i, err)
+				case !step.full && got != step.want:
+					t.Fatalf("step %d: Allocate() = %s, want %s", i, got, step.want)
+				case !step.full && (ipam.Allocations()[got] != step.owner || ipam.Last() != got):
+					t.Fatalf("step %d: %s isn't recorded for %s", i, got, step.owner)
+				}
+			}
+		})
+	}
+}
+
+func TestNewIPAMRejectsForeignAddresses(t *testing.T) {
+	for _, addr := range []string{"10.0.0.2", "not-an-address"} {
+		if _, err := NewIPAM("172.28.0.0/16", map[string]string{addr: "a"}, ""); err == nil {
+			t.Errorf("NewIPAM() accepted allocated address %q outside the subnet", addr)
+		}
+	}
+}
+
+func TestIPAMRoundTrip(t *testing.T) {
+	ipam, _ := NewIPAM("172.28.0.0/16", nil, "")
+	if ipam.Last() != "" || ipam.Subnet() != "172.28.0.0/16" {
+		t.Fatalf("new IPAM has Last() %q and Subnet() %q", ipam.Last(), ipam.Subnet())
+	}
+	for _, owner := range []string{"a", "b", "c"} {
+		ipam.Allocate(owner)
+	}
+	ipam.Release("172.28.0.3")
+	restored, err := NewIPAM(ipam.Subnet(), ipam.Allocations(), ipam.Last())
+	if err != nil {
+		t.Fatalf("NewIPAM() = %v", err)
+	}
+	for _, want := range []string{"172.28.0.5", "172.28.0.6"} {
+		if got, _ := restored.Allocate("d"); got != want {
+			t.Errorf("restored Allocate() = %s, want %s", got, want)
+		}
+	}
+}
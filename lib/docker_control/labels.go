@@ -0,0 +1,70 @@
+package docker_control
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Labels stamped on every Docker resource the testnet creates
+const (
+	// LABEL_TESTNET holds the ID of the testnet that owns a resource
+	LABEL_TESTNET = "org.go-i2p.testnet.id"
+	// LABEL_NAME holds the name of the testnet that owns a resource
+	LABEL_NAME = "org.go-i2p.testnet.name"
+	// LABEL_ROLE describes what the resource is used for, one of the ROLE_* values
+	LABEL_ROLE = "org.go-i2p.testnet.role"
+	// LABEL_KIND holds the router kind of router containers and their volumes
+	LABEL_KIND = "org.go-i2p.testnet.kind"
+)
+
+// Values of LABEL_ROLE
+const (
+	ROLE_NETWORK = "network"
+	ROLE_SHARED  = "shared"
+	ROLE_ROUTER  = "router"
+	ROLE_CONFIG  = "config"
+	ROLE_HELPER  = "helper"
+	// ROLE_NAT marks the gateway containers and private networks of routers behind a NAT
+	ROLE_NAT = "nat"
+)
+
+// NewTestnetID returns a random ID identifying the resources of one testnet
+func NewTestnetID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Labels returns the labels for a resource with the given role owned by the testnet
+func (t TestnetRef) Labels(role string) map[string]string {
+	return map[string]string{
+		LABEL_TESTNET: t.ID,
+		LABEL_NAME:    t.Name,
+		LABEL_ROLE:    role,
+	}
+}
+
+// RouterLabels returns the labels for a router container or volume of the given kind
+func (t TestnetRef) RouterLabels(role string, kind string) map[string]string {
+	labels := t.Labels(role)
+	labels[LABEL_KIND] = kind
+	return labels
+}
+
+// TestnetFilter matches resources owned by the testnet, or by any testnet if testnetID is empty
+func TestnetFilter(testnetID string) filters.Args {
+	if testnetID == "" {
+		return filters.NewArgs(filters.Arg("label", LABEL_TESTNET))
+	}
+	return filters.NewArgs(filters.Arg("label", LABEL_TESTNET+"="+testnetID))
+}
+
+// RouterFilter matches the router containers of the testnet, or of any testnet if testnetID is empty
+func RouterFilter(testnetID string) filters.Args {
+	f := TestnetFilter(testnetID)
+	f.Add("label", LABEL_ROLE+"="+ROLE_ROUTER)
+	return f
+}
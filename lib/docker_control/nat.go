@@ -0,0 +1,192 @@
+package docker_control
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"net/netip"
+	"strings"
+)
+
+// natScript turns a container attached to the testnet network and a router's private network into the router's NAT
+// gateway, then idles until it is stopped. It is run as `sh -c natScript sh <full-cone|symmetric> <public IP> <router IP>`.
+// A full-cone gateway keeps the router's source ports and forwards everything sent to its public address to the
+// router. A symmetric one picks a random port for every connection and only lets in replies.
+const natScript = `mode=$1 public=$2 router=$3
+dev=$(ip -o -4 addr show | awk -v ip="$public" 'index($4, ip "/") == 1 { print $2 }')
+[ -n "$dev" ] || { echo "no interface has address $public"; exit 1; }
+case $mode in
+full-cone)
+	iptables -t nat -A POSTROUTING -o "$dev" -j MASQUERADE || exit 1
+	iptables -t nat -A PREROUTING -i "$dev" -d "$public" -j DNAT --to-destination "$router" || exit 1 ;;
+symmetric)
+	iptables -t nat -A POSTROUTING -o "$dev" -j MASQUERADE --random-fully || exit 1 ;;
+*)
+	echo "unknown NAT $mode"; exit 1 ;;
+esac
+echo "$mode NAT from $router to $public on $dev"
+trap 'exit 0' TERM INT
+while true; do sleep 3600 & wait $!; done`
+
+// routeScript makes a gateway the default route of a network namespace. It is run as `sh -c routeScript sh <gateway>`.
+const routeScript = `ip route replace default via "$1"`
+
+// NATNetwork is the private network between a router behind a NAT and its gateway
+type NATNetwork struct {
+	Name   string
+	Subnet string
+	// GatewayIP and RouterIP are the addresses of the gateway container and the router on the network
+	GatewayIP string
+	RouterIP  string
+}
+
+// NATGateway describes the gateway container of a router behind a NAT
+type NATGateway struct {
+	Name string
+	// Mode is the kind of NAT, full-cone or symmetric
+	Mode string
+	// IP and IPv6 are the gateway's addresses on the testnet network, the router's peers see its traffic come from IP
+	IP   string
+	IPv6 string
+}
+
+// natCandidateSubnets lists the /24 subnets the private networks of routers behind a NAT are placed on, apart
+// from the ones testnet networks use
+func natCandidateSubnets() []string {
+	var subnets []string
+	for i := 100; i <= 127; i++ {
+		for j := 0; j <= 255; j++ {
+			subnets = append(subnets, fmt.Sprintf("10.%d.%d.0/24", i, j))
+		}
+	}
+	return subnets
+}
+
+// CreateNATNetwork creates the internal network a router behind a NAT is put on, on a subnet no other Docker network
+// uses. The gateway gets the first address after Docker's own, the router the one after it.
+func CreateNATNetwork(cli *client.Client, ctx context.Context, ref TestnetRef, name string) (NATNetwork, error) {
+	log.WithField("networkName", name).Debug("Creating NAT network")
+	for attempt := 1; ; attempt++ {
+		networks, err := cli.NetworkList(ctx, network.ListOptions{})
+		if err != nil {
+			log.WithError(err).Error("Failed to list Docker networks")
+			return NATNetwork{}, err
+		}
+		subnet, err := freeSubnet(networks, natCandidateSubnets())
+		if err != nil {
+			return NATNetwork{}, err
+		}
+		_, err = cli.NetworkCreate(ctx, name, network.CreateOptions{
+			Driver: "bridge",
+			// The gateway is the only way out, not the host
+			Internal: true,
+			Labels:   ref.Labels(ROLE_NAT),
+			IPAM: &network.IPAM{
+				Config: []network.IPAMConfig{{Subnet: subnet}},
+			},
+		})
+		if err == nil {
+			prefix := netip.MustParsePrefix(subnet)
+			gateway := prefix.Addr().Next().Next()
+			log.WithFields(map[string]interface{}{
+				"networkName": name,
+				"subnet":      subnet,
+			}).Debug("Successfully created NAT network")
+			return NATNetwork{Name: name, Subnet: subnet, GatewayIP: gateway.String(), RouterIP: gateway.Next().String()}, nil
+		}
+		if attempt >= SUBNET_ATTEMPTS || !strings.Contains(err.Error(), "overlap") {
+			log.WithError(err).Error("Failed to create NAT network")
+			return NATNetwork{}, fmt.Errorf("error creating NAT network %s: %v", name, err)
+		}
+		log.WithField("subnet", subnet).Debug("Subnet was taken in the meantime, retrying")
+	}
+}
+
+// CreateNATGateway creates and starts the gateway container between the testnet network and a NAT network, which
+// masquerades the router's traffic as coming from the gateway's own address. It returns the container ID.
+func CreateNATGateway(cli *client.Client, ctx context.Context, ref TestnetRef, gw NATGateway, lan NATNetwork) (string, error) {
+	log.WithFields(map[string]interface{}{
+		"containerName": gw.Name,
+		"mode":          gw.Mode,
+		"ip":            gw.IP,
+		"networkName":   lan.Name,
+	}).Debug("Creating NAT gateway")
+
+	resp, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:  NETEM_IMAGE,
+		Cmd:    []string{"sh", "-c", natScript, "sh", gw.Mode, gw.IP, lan.RouterIP},
+		Labels: ref.Labels(ROLE_NAT),
+	}, &container.HostConfig{
+		CapAdd:  []string{"NET_ADMIN"},
+		Sysctls: map[string]string{"net.ipv4.ip_forward": "1"},
+	}, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			ref.NetworkName(): {
+				IPAMConfig: &network.EndpointIPAMConfig{
+					IPv4Address: gw.IP,
+					IPv6Address: gw.IPv6,
+				},
+			},
+		},
+	}, nil, gw.Name)
+	if err != nil {
+		return "", fmt.Errorf("error creating NAT gateway %s: %v", gw.Name, err)
+	}
+	removeContainer := func() {
+		if err := cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			log.WithError(err).Error("Failed to remove NAT gateway after failed setup")
+		}
+	}
+
+	// Only one network can be given on creation with older daemons
+	err = cli.NetworkConnect(ctx, lan.Name, resp.ID, &network.EndpointSettings{
+		IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: lan.GatewayIP},
+	})
+	if err != nil {
+		removeContainer()
+		return "", fmt.Errorf("error connecting NAT gateway %s to %s: %v", gw.Name, lan.Name, err)
+	}
+	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		removeContainer()
+		return "", fmt.Errorf("error starting NAT gateway %s: %v", gw.Name, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"containerID":   resp.ID,
+		"containerName": gw.Name,
+	}).Debug("Successfully started NAT gateway")
+	return resp.ID, nil
+}
+
+// RemoveNATGateway removes the gateway container and the NAT network of a router behind a NAT, the router has to be
+// removed first. Either may be gone already.
+func RemoveNATGateway(cli *client.Client, ctx context.Context, containerID string, networkName string) error {
+	if containerID != "" {
+		err := cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("error removing NAT gateway %s: %v", containerID, err)
+		}
+	}
+	if err := cli.NetworkRemove(ctx, networkName); err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("error removing NAT network %s: %v", networkName, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"containerID": containerID,
+		"networkName": networkName,
+	}).Debug("Removed NAT gateway")
+	return nil
+}
+
+// RouteThroughGateway makes the NAT gateway the default route of a running router container. Docker gives
+// containers of an internal network no default route, and takes this one away whenever the container stops.
+func RouteThroughGateway(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, gateway string) error {
+	if _, err := RunSidecar(cli, ctx, ref, containerID, NETEM_IMAGE, []string{"sh", "-c", routeScript, "sh", gateway}); err != nil {
+		return fmt.Errorf("error routing %s through its NAT gateway: %v", containerID, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"containerID": containerID,
+		"gateway":     gateway,
+	}).Debug("Routed container through NAT gateway")
+	return nil
+}
@@ -0,0 +1,122 @@
+package docker_control
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"strings"
+)
+
+const (
+	// NETEM_IMAGE runs the sidecars that change a router's network configuration with iproute2:
+	// link conditions with tc, partitions with blackhole routes and address families.
+	// NAT gateways run it too, for iptables.
+	NETEM_IMAGE = "go-i2p-testnet-netem"
+	// NETEM_DOCKERFILE is the embedded Dockerfile of NETEM_IMAGE
+	NETEM_DOCKERFILE = "netem-sidecar.dockerfile"
+)
+
+// netemScript sets, clears or shows the netem qdisc on the interface that holds one of the given comma separated
+// addresses, the router's link to the testnet, then prints that interface's qdisc. Other links, e.g. to the publish
+// network the host reaches the router over, keep their conditions.
+// It is run as `sh -c netemScript sh <set|clear|show> <addresses> [netem args...]`.
+const netemScript = `mode=$1 addresses=$2; shift 2
+dev=$(ip -o addr show | awk -v addresses="$addresses" '
+	BEGIN { split(addresses, want, ",") }
+	{ split($4, a, "/"); for (i in want) if (a[1] == want[i]) { sub(/@.*/, "", $2); print $2; exit } }')
+if [ -z "$dev" ]; then
+	echo "no interface has the address $addresses" >&2
+	exit 1
+fi
+case $mode in
+set) tc qdisc replace dev "$dev" root netem "$@" || exit 1 ;;
+clear) tc qdisc del dev "$dev" root 2>/dev/null ;;
+esac
+echo "$dev: $(tc qdisc show dev "$dev" | head -n 1)"`
+
+// BuildNetemImage builds NETEM_IMAGE, unless an up to date image exists
+func BuildNetemImage(cli *client.Client, ctx context.Context) error {
+	return BuildDockerImage(cli, ctx, NETEM_IMAGE, NETEM_DOCKERFILE)
+}
+
+// RunSidecar runs cmd in a short-lived container that shares the network namespace of a running container and may
+// change its network configuration, so the container's own image needs no tools or privileges. It returns the output.
+func RunSidecar(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, image string, cmd []string) (string, error) {
+	log.WithFields(map[string]interface{}{
+		"containerID": containerID,
+		"image":       image,
+		"cmd":         cmd,
+	}).Debug("Running sidecar")
+
+	resp, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:  image,
+		Cmd:    cmd,
+		Labels: ref.Labels(ROLE_HELPER),
+	}, &container.HostConfig{
+		NetworkMode: container.NetworkMode("container:" + containerID),
+		CapAdd:      []string{"NET_ADMIN"},
+	}, nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("error creating sidecar: %v", err)
+	}
+	defer func() {
+		if err := cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			log.WithError(err).Error("Failed to remove sidecar")
+		}
+	}()
+
+	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return "", fmt.Errorf("error starting sidecar: %v", err)
+	}
+	var exitCode int64
+	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return "", fmt.Errorf("error waiting for sidecar: %v", err)
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+	}
+
+	reader, err := cli.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return "", fmt.Errorf("error reading sidecar output: %v", err)
+	}
+	defer reader.Close()
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, reader); err != nil {
+		return "", fmt.Errorf("error reading sidecar output: %v", err)
+	}
+	if exitCode != 0 {
+		return out.String(), fmt.Errorf("sidecar exited with status %d: %s", exitCode, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// runNetem runs netemScript in a sidecar of a router container
+func runNetem(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, addresses []string, mode string, args []string) (string, error) {
+	cmd := append([]string{"sh", "-c", netemScript, "sh", mode, strings.Join(addresses, ",")}, args...)
+	out, err := RunSidecar(cli, ctx, ref, containerID, NETEM_IMAGE, cmd)
+	if err != nil {
+		return "", fmt.Errorf("error running tc in the network namespace of %s: %v", containerID, err)
+	}
+	return out, nil
+}
+
+// SetNetem installs a netem qdisc with the given parameters on the interface of a running router container that holds
+// one of addresses, replacing any earlier one, and returns the resulting qdisc
+func SetNetem(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, addresses []string, args []string) (string, error) {
+	return runNetem(cli, ctx, ref, containerID, addresses, "set", args)
+}
+
+// ClearNetem removes the netem qdisc from the interface of a running router container that holds one of addresses
+func ClearNetem(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, addresses []string) (string, error) {
+	return runNetem(cli, ctx, ref, containerID, addresses, "clear", nil)
+}
+
+// ShowNetem returns the root qdisc of the interface of a running router container that holds one of addresses
+func ShowNetem(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, addresses []string) (string, error) {
+	return runNetem(cli, ctx, ref, containerID, addresses, "show", nil)
+}
@@ -2,57 +2,194 @@ package docker_control
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"net"
+	"net/netip"
+	"strings"
 )
 
-func CreateDockerNetwork(cli *client.Client, ctx context.Context, networkName string) (string, error) {
+// SUBNET_ATTEMPTS is how often CreateDockerNetwork picks a new subnet when another testnet took the chosen one first
+const SUBNET_ATTEMPTS = 5
+
+// CreateDockerNetwork creates the testnet's network on the given subnet or, if it is empty, on a subnet no other
+// Docker network uses. With ipv6 the network is dual-stack, on subnet6 or, if it is empty, on a random unique local
+// /64. An existing network of the same name is reused if it has the subnets asked for and isn't left over from another
+// testnet. It returns the network ID and its subnets.
+func CreateDockerNetwork(cli *client.Client, ctx context.Context, ref TestnetRef, subnet string, ipv6 bool, subnet6 string) (string, string, string, error) {
+	networkName := ref.NetworkName()
 	log.WithField("networkName", networkName).Debug("Starting Docker network creation")
 	// Check if the network already exists
 	log.Debug("Checking for existing networks")
 	networks, err := cli.NetworkList(ctx, network.ListOptions{})
 	if err != nil {
 		log.WithError(err).Error("Failed to list Docker networks")
-		return "", err
+		return "", "", "", err
 	}
-	for _, net := range networks {
-		if net.Name == networkName {
+	for _, existing := range networks {
+		if existing.Name == networkName {
+			// Its routers' addresses aren't known, new routers would clash with them
+			if id := existing.Labels[LABEL_TESTNET]; id != "" && id != ref.ID {
+				return "", "", "", fmt.Errorf("network %s already exists and belongs to testnet %s, which is no longer running; remove its leftovers with prune", networkName, id)
+			}
+			existingSubnet, existingSubnet6 := "", ""
+			for _, config := range existing.IPAM.Config {
+				if strings.Contains(config.Subnet, ":") {
+					existingSubnet6 = config.Subnet
+				} else if existingSubnet == "" {
+					existingSubnet = config.Subnet
+				}
+			}
+			// Reusing the network with other subnets would silently ignore the ones asked for
+			if subnet != "" && !sameSubnet(subnet, existingSubnet) {
+				return "", "", "", fmt.Errorf("network %s already exists on subnet %s, not %s", networkName, existingSubnet, subnet)
+			}
+			if ipv6 && existingSubnet6 == "" {
+				return "", "", "", fmt.Errorf("network %s already exists without IPv6", networkName)
+			}
+			if subnet6 != "" && !sameSubnet(subnet6, existingSubnet6) {
+				return "", "", "", fmt.Errorf("network %s already exists on IPv6 subnet %s, not %s", networkName, existingSubnet6, subnet6)
+			}
 			log.WithFields(map[string]interface{}{
 				"networkName": networkName,
-				"networkID":   net.ID,
+				"networkID":   existing.ID,
+				"subnet":      existingSubnet,
+				"subnet6":     existingSubnet6,
 			}).Debug("Network already exists, using existing network")
-			return net.ID, nil
+			return existing.ID, existingSubnet, existingSubnet6, nil
 		}
 	}
 
-	// Create the network
-	createOptions := network.CreateOptions{
-		Driver:   "bridge",
-		Internal: true, // Isolates from clearnet
-		IPAM: &network.IPAM{
-			Config: []network.IPAMConfig{
-				{
-					Subnet: "172.28.0.0/16",
+	if ipv6 && subnet6 == "" {
+		if subnet6, err = RandomULASubnet(); err != nil {
+			return "", "", "", err
+		}
+	}
+
+	// Testnets started at the same time can pick the same free subnet, the loser retries with a fresh list
+	var resp network.CreateResponse
+	chosen := subnet != ""
+	for attempt := 1; ; attempt++ {
+		if !chosen {
+			subnet, err = freeSubnet(networks, candidateSubnets())
+			if err != nil {
+				log.WithError(err).Error("Failed to find a free subnet")
+				return "", "", "", err
+			}
+		}
+
+		// Create the network
+		enableIPv6 := subnet6 != ""
+		createOptions := network.CreateOptions{
+			Driver:     "bridge",
+			Internal:   true, // Isolates from clearnet
+			EnableIPv6: &enableIPv6,
+			Labels:     ref.Labels(ROLE_NETWORK),
+			IPAM: &network.IPAM{
+				Config: []network.IPAMConfig{
+					{
+						Subnet: subnet,
+					},
 				},
 			},
-		},
-	}
+		}
+		if enableIPv6 {
+			createOptions.IPAM.Config = append(createOptions.IPAM.Config, network.IPAMConfig{Subnet: subnet6})
+		}
 
-	log.WithFields(map[string]interface{}{
-		"networkName": networkName,
-		"driver":      createOptions.Driver,
-		"subnet":      createOptions.IPAM.Config[0].Subnet,
-		"internal":    createOptions.Internal,
-	}).Debug("Creating new Docker network")
+		log.WithFields(map[string]interface{}{
+			"networkName": networkName,
+			"driver":      createOptions.Driver,
+			"subnet":      subnet,
+			"subnet6":     subnet6,
+			"internal":    createOptions.Internal,
+		}).Debug("Creating new Docker network")
 
-	resp, err := cli.NetworkCreate(ctx, networkName, createOptions)
-	if err != nil {
-		log.WithError(err).Error("Failed to create Docker network")
-		return "", err
+		resp, err = cli.NetworkCreate(ctx, networkName, createOptions)
+		if err == nil {
+			break
+		}
+		if chosen || attempt >= SUBNET_ATTEMPTS || !strings.Contains(err.Error(), "overlap") {
+			log.WithError(err).Error("Failed to create Docker network")
+			return "", "", "", err
+		}
+		log.WithField("subnet", subnet).Debug("Subnet was taken in the meantime, retrying")
+		networks, err = cli.NetworkList(ctx, network.ListOptions{})
+		if err != nil {
+			log.WithError(err).Error("Failed to list Docker networks")
+			return "", "", "", err
+		}
 	}
 	log.WithFields(map[string]interface{}{
 		"networkName": networkName,
 		"networkID":   resp.ID,
 	}).Debug("Successfully created Docker network")
-	return resp.ID, nil
+	return resp.ID, subnet, subnet6, nil
+}
+
+// RandomULASubnet returns a /64 of a random IPv6 unique local address prefix (RFC 4193), which no other network is
+// likely to use
+func RandomULASubnet() (string, error) {
+	var globalID [5]byte
+	if _, err := rand.Read(globalID[:]); err != nil {
+		return "", fmt.Errorf("error generating IPv6 subnet: %v", err)
+	}
+	var addr [16]byte
+	addr[0] = 0xfd
+	copy(addr[1:6], globalID[:])
+	return netip.PrefixFrom(netip.AddrFrom16(addr), 64).String(), nil
+}
+
+// sameSubnet reports whether two subnets in CIDR notation are the same, however they are written
+func sameSubnet(a string, b string) bool {
+	prefixA, errA := netip.ParsePrefix(a)
+	prefixB, errB := netip.ParsePrefix(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return prefixA.Masked() == prefixB.Masked()
+}
+
+// candidateSubnets lists the /16 subnets testnets are placed on, in order of preference
+func candidateSubnets() []string {
+	var subnets []string
+	for i := 28; i <= 31; i++ {
+		subnets = append(subnets, fmt.Sprintf("172.%d.0.0/16", i))
+	}
+	for i := 128; i <= 255; i++ {
+		subnets = append(subnets, fmt.Sprintf("10.%d.0.0/16", i))
+	}
+	return subnets
+}
+
+// freeSubnet returns the first of the candidate subnets that does not overlap any existing network
+func freeSubnet(networks []network.Summary, candidates []string) (string, error) {
+	var used []*net.IPNet
+	for _, n := range networks {
+		for _, config := range n.IPAM.Config {
+			_, ipNet, err := net.ParseCIDR(config.Subnet)
+			if err != nil {
+				continue
+			}
+			used = append(used, ipNet)
+		}
+	}
+
+	for _, candidate := range candidates {
+		_, ipNet, _ := net.ParseCIDR(candidate)
+		overlaps := false
+		for _, u := range used {
+			if u.Contains(ipNet.IP) || ipNet.Contains(u.IP) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			log.WithField("subnet", candidate).Debug("Found free subnet")
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free subnet left for a new network")
 }
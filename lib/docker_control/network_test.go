@@ -0,0 +1,39 @@
+package docker_control
+
+import (
+	"github.com/docker/docker/api/types/network"
+	"testing"
+)
+
+func TestSameSubnet(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"172.28.0.0/16", "172.28.0.0/16", true},
+		{"10.200.0.0/20", "10.200.3.0/20", true},
+		{"fd00:0:0:1::/64", "fd00::1:0:0:0:0/64", true},
+		{"172.28.0.0/16", "172.29.0.0/16", false},
+		{"172.28.0.0/16", "172.28.0.0/24", false},
+		{"172.28.0.0/16", "", false},
+	}
+	for _, tt := range tests {
+		if got := sameSubnet(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameSubnet(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFreeSubnet(t *testing.T) {
+	networks := []network.Summary{
+		{IPAM: network.IPAM{Config: []network.IPAMConfig{{Subnet: "172.28.0.0/16"}}}},
+		{IPAM: network.IPAM{Config: []network.IPAMConfig{{Subnet: "172.29.5.0/24"}, {Subnet: "fd00::/64"}}}},
+	}
+	got, err := freeSubnet(networks, candidateSubnets())
+	if err != nil || got != "172.30.0.0/16" {
+		t.Errorf("freeSubnet() = %q, %v, want 172.30.0.0/16", got, err)
+	}
+	if _, err := freeSubnet(networks, []string{"172.28.0.0/16", "172.29.0.0/16"}); err == nil {
+		t.Error("freeSubnet() found a subnet when every candidate overlaps")
+	}
+}
@@ -1,21 +1,88 @@
 package docker_control
 
+import (
+	"regexp"
+	"strings"
+)
+
+// VERSION_LATEST is the version of a node image built from the default Dockerfile with nothing pinned
+const VERSION_LATEST = "latest"
+
+// LABEL_VERSION holds the version a node image was built at; containers inherit it from their image
+const LABEL_VERSION = "org.go-i2p.testnet.version"
+
 type NodeType struct {
 	ImageName      string
 	DockerfileName string
+	// SourceDockerfileName builds the image from a local checkout instead, empty if the kind can't be built that way
+	SourceDockerfileName string
+	// VersionArg is the build argument a version is passed in, empty if the kind can't be built at a version
+	VersionArg string
+	// VersionDockerfileName builds the image at a pinned version, if DockerfileName can't
+	VersionDockerfileName string
 }
 
 var (
 	GoI2PNode = NodeType{
-		ImageName:      "go-i2p-node",
-		DockerfileName: "go-i2p-node.dockerfile",
+		ImageName:            "go-i2p-node",
+		DockerfileName:       "go-i2p-node.dockerfile",
+		SourceDockerfileName: "go-i2p-node-src.dockerfile",
+		// Any git ref of the go-i2p repository: a branch, tag or commit
+		VersionArg: "GO_I2P_REF",
 	}
 	I2PDNode = NodeType{
 		ImageName:      "i2pd-node",
 		DockerfileName: "i2pd-node.dockerfile",
+		// An i2pd release tag, Alpine only packages the current release so others are built from source
+		VersionArg:            "I2PD_VERSION",
+		VersionDockerfileName: "i2pd-node-version.dockerfile",
 	}
 	I2PJavaNode = NodeType{
 		ImageName:      "i2p-java-node",
 		DockerfileName: "i2p-java-node.dockerfile",
+		// A tag of the geti2p/i2p image, i.e. an I2P release
+		VersionArg: "I2P_VERSION",
 	}
 )
+
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// NormalizeVersion returns VERSION_LATEST for an unset version
+func NormalizeVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return VERSION_LATEST
+	}
+	return version
+}
+
+// VersionTag turns a version into a valid image tag, e.g. the git ref "feature/ssu2" becomes "feature-ssu2"
+func VersionTag(version string) string {
+	tag := invalidTagChars.ReplaceAllString(NormalizeVersion(version), "-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return strings.TrimLeft(tag, ".-")
+}
+
+// ImageRepository returns an image reference without its tag, e.g. "i2pd-node" for "i2pd-node:2.54.0"
+func ImageRepository(image string) string {
+	// A colon after the last slash starts the tag, one before it belongs to a registry port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+// Image returns the image reference of the node type at a version
+func (n NodeType) Image(version string) string {
+	return n.ImageName + ":" + VersionTag(version)
+}
+
+// Dockerfile returns the Dockerfile the node type is built from at a version
+func (n NodeType) Dockerfile(version string) string {
+	if NormalizeVersion(version) != VERSION_LATEST && n.VersionDockerfileName != "" {
+		return n.VersionDockerfileName
+	}
+	return n.DockerfileName
+}
@@ -0,0 +1,87 @@
+package docker_control
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersionTag(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"", VERSION_LATEST},
+		{"  ", VERSION_LATEST},
+		{"2.54.0", "2.54.0"},
+		{" 2.54.0\n", "2.54.0"},
+		{"feature/ssu2", "feature-ssu2"},
+		{"v0.1.0+build:1", "v0.1.0-build-1"},
+		{".hidden", "hidden"},
+		{"-/rc", "rc"},
+		{"release_2.x", "release_2.x"},
+		{strings.Repeat("a", 200), strings.Repeat("a", 128)},
+	}
+	for _, tt := range tests {
+		if got := VersionTag(tt.version); got != tt.want {
+			t.Errorf("VersionTag(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestImageRepository(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"i2pd-node", "i2pd-node"},
+		{"i2pd-node:2.54.0", "i2pd-node"},
+		{"geti2p/i2p:latest", "geti2p/i2p"},
+		{"localhost:5000/i2pd-node", "localhost:5000/i2pd-node"},
+		{"localhost:5000/i2pd-node:2.54.0", "localhost:5000/i2pd-node"},
+		{"registry.example.com:443/team/go-i2p-node:feature-ssu2", "registry.example.com:443/team/go-i2p-node"},
+	}
+	for _, tt := range tests {
+		if got := ImageRepository(tt.image); got != tt.want {
+			t.Errorf("ImageRepository(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestNodeTypeImage(t *testing.T) {
+	tests := []struct {
+		version string
+		image   string
+	}{
+		{"", "i2pd-node:latest"},
+		{"latest", "i2pd-node:latest"},
+		{"2.54.0", "i2pd-node:2.54.0"},
+		{"feature/ssu2", "i2pd-node:feature-ssu2"},
+	}
+	for _, tt := range tests {
+		if image := I2PDNode.Image(tt.version); image != tt.image {
+			t.Errorf("Image(%q) = %q, want %q", tt.version, image, tt.image)
+		}
+		if repository := ImageRepository(I2PDNode.Image(tt.version)); repository != I2PDNode.ImageName {
+			t.Errorf("ImageRepository(Image(%q)) = %q, want %q", tt.version, repository, I2PDNode.ImageName)
+		}
+	}
+}
+
+func TestNodeTypeDockerfile(t *testing.T) {
+	tests := []struct {
+		node       NodeType
+		version    string
+		dockerfile string
+	}{
+		{I2PDNode, "", I2PDNode.DockerfileName},
+		{I2PDNode, " latest ", I2PDNode.DockerfileName},
+		{I2PDNode, "2.54.0", I2PDNode.VersionDockerfileName},
+		{I2PJavaNode, "2.7.0", I2PJavaNode.DockerfileName},
+		{GoI2PNode, "main", GoI2PNode.DockerfileName},
+	}
+	for _, tt := range tests {
+		if dockerfile := tt.node.Dockerfile(tt.version); dockerfile != tt.dockerfile {
+			t.Errorf("%s Dockerfile(%q) = %q, want %q", tt.node.ImageName, tt.version, dockerfile, tt.dockerfile)
+		}
+	}
+}
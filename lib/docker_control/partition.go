@@ -0,0 +1,59 @@
+package docker_control
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+)
+
+// partitionScript replaces the blackhole routes of a network namespace with one for each address given, so
+// packets to those addresses are dropped while every other peer stays reachable. Without addresses it only
+// removes them. It is run as `sh -c partitionScript sh [address...]`.
+const partitionScript = `for family in -4 -6; do
+	ip $family route show type blackhole | while read -r _ dst _; do
+		ip $family route del blackhole "$dst"
+	done
+done
+for addr in "$@"; do
+	ip route replace blackhole "$addr" || exit 1
+done
+echo "blocked $# addresses"`
+
+// BlockPeers drops all traffic of a running router container to the given addresses, replacing the addresses
+// blocked before. The container keeps its interfaces and addresses, it only loses the routes to those peers.
+func BlockPeers(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, addrs []string) error {
+	cmd := append([]string{"sh", "-c", partitionScript, "sh"}, addrs...)
+	if _, err := RunSidecar(cli, ctx, ref, containerID, NETEM_IMAGE, cmd); err != nil {
+		return fmt.Errorf("error changing the routes in the network namespace of %s: %v", containerID, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"containerID": containerID,
+		"blocked":     len(addrs),
+	}).Debug("Replaced blocked peers")
+	return nil
+}
+
+// blockScript adds a blackhole route for each address given and keeps the ones there are.
+// It is run as `sh -c blockScript sh address...`.
+const blockScript = `for addr in "$@"; do
+	ip route replace blackhole "$addr" || exit 1
+done`
+
+// BlockPeer drops all traffic of a running router container to the addresses of one more peer, keeping the addresses
+// blocked before
+func BlockPeer(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string, addrs []string) error {
+	cmd := append([]string{"sh", "-c", blockScript, "sh"}, addrs...)
+	if _, err := RunSidecar(cli, ctx, ref, containerID, NETEM_IMAGE, cmd); err != nil {
+		return fmt.Errorf("error changing the routes in the network namespace of %s: %v", containerID, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"containerID": containerID,
+		"blocked":     addrs,
+	}).Debug("Blocked peer")
+	return nil
+}
+
+// UnblockPeers lets a running router container reach every peer again
+func UnblockPeers(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string) error {
+	return BlockPeers(cli, ctx, ref, containerID, nil)
+}
@@ -0,0 +1,118 @@
+package docker_control
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// Kinds of Resource, in the order they have to be removed
+const (
+	RESOURCE_CONTAINER = "container"
+	RESOURCE_VOLUME    = "volume"
+	RESOURCE_NETWORK   = "network"
+)
+
+// Resource is a labelled Docker object created by a testnet
+type Resource struct {
+	Type        string
+	ID          string
+	Name        string
+	TestnetID   string
+	TestnetName string
+	Role        string
+}
+
+// ListTestnetResources finds every container, volume and network labelled as belonging to a testnet.
+// Resources are returned containers first, then volumes, then networks so they can be removed in order.
+func ListTestnetResources(cli *client.Client, ctx context.Context) ([]Resource, error) {
+	log.Debug("Listing labelled testnet resources")
+	var resources []Resource
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: TestnetFilter("")})
+	if err != nil {
+		log.WithError(err).Error("Failed to list containers")
+		return nil, fmt.Errorf("error listing containers: %v", err)
+	}
+	for _, c := range containers {
+		name := c.ID[:12]
+		if len(c.Names) > 0 {
+			name = c.Names[0][1:]
+		}
+		resources = append(resources, Resource{
+			Type:        RESOURCE_CONTAINER,
+			ID:          c.ID,
+			Name:        name,
+			TestnetID:   c.Labels[LABEL_TESTNET],
+			TestnetName: c.Labels[LABEL_NAME],
+			Role:        c.Labels[LABEL_ROLE],
+		})
+	}
+
+	volumes, err := cli.VolumeList(ctx, volume.ListOptions{Filters: TestnetFilter("")})
+	if err != nil {
+		log.WithError(err).Error("Failed to list volumes")
+		return nil, fmt.Errorf("error listing volumes: %v", err)
+	}
+	for _, v := range volumes.Volumes {
+		resources = append(resources, Resource{
+			Type:        RESOURCE_VOLUME,
+			ID:          v.Name,
+			Name:        v.Name,
+			TestnetID:   v.Labels[LABEL_TESTNET],
+			TestnetName: v.Labels[LABEL_NAME],
+			Role:        v.Labels[LABEL_ROLE],
+		})
+	}
+
+	networks, err := cli.NetworkList(ctx, network.ListOptions{Filters: TestnetFilter("")})
+	if err != nil {
+		log.WithError(err).Error("Failed to list networks")
+		return nil, fmt.Errorf("error listing networks: %v", err)
+	}
+	for _, n := range networks {
+		resources = append(resources, Resource{
+			Type:        RESOURCE_NETWORK,
+			ID:          n.ID,
+			Name:        n.Name,
+			TestnetID:   n.Labels[LABEL_TESTNET],
+			TestnetName: n.Labels[LABEL_NAME],
+			Role:        n.Labels[LABEL_ROLE],
+		})
+	}
+
+	log.WithField("count", len(resources)).Debug("Found labelled testnet resources")
+	return resources, nil
+}
+
+// RemoveResource force-removes a container, volume or network found by ListTestnetResources
+func RemoveResource(cli *client.Client, ctx context.Context, r Resource) error {
+	log.WithFields(map[string]interface{}{
+		"type": r.Type,
+		"name": r.Name,
+	}).Debug("Removing testnet resource")
+
+	var err error
+	switch r.Type {
+	case RESOURCE_CONTAINER:
+		err = cli.ContainerRemove(ctx, r.ID, container.RemoveOptions{Force: true})
+	case RESOURCE_VOLUME:
+		err = cli.VolumeRemove(ctx, r.ID, true)
+	case RESOURCE_NETWORK:
+		err = cli.NetworkRemove(ctx, r.ID)
+	default:
+		err = fmt.Errorf("unknown resource type %q", r.Type)
+	}
+	if err != nil {
+		log.WithFields(map[string]interface{}{
+			"type":  r.Type,
+			"name":  r.Name,
+			"error": err,
+		}).Error("Failed to remove testnet resource")
+		return fmt.Errorf("error removing %s %s: %v", r.Type, r.Name, err)
+	}
+	return nil
+}
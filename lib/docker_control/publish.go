@@ -0,0 +1,114 @@
+package docker_control
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"net"
+	"net/netip"
+)
+
+// PUBLISH_HOST_IP is the host address published ports are bound to, so they aren't reachable from other machines
+const PUBLISH_HOST_IP = "127.0.0.1"
+
+// isolateScript removes the default route a container gets from the publish network, so the router stays cut off
+// from the internet while the host can still reach its published ports. It also narrows the route to the publish
+// network down to its gateway, the host, so routers can't reach each other over it, around a partition for one.
+// It is run as `sh -c isolateScript sh <subnet> <gateway>`.
+const isolateScript = `subnet=$1 gateway=$2
+while ip -4 route del default 2>/dev/null; do :; done
+dev=$(ip -4 route show "$subnet" | awk '{ for (i = 1; i < NF; i++) if ($i == "dev") { print $(i + 1); exit } }')
+# Without the subnet route the container is isolated already
+[ -n "$dev" ] || exit 0
+ip -4 route replace "$gateway" dev "$dev" || exit 1
+ip -4 route del "$subnet" dev "$dev"`
+
+// portBindings publishes the TCP ports of a container on auto-assigned ports of PUBLISH_HOST_IP
+func portBindings(ports []int) (nat.PortSet, nat.PortMap) {
+	exposed := nat.PortSet{}
+	bindings := nat.PortMap{}
+	for _, p := range ports {
+		port := nat.Port(fmt.Sprintf("%d/tcp", p))
+		exposed[port] = struct{}{}
+		bindings[port] = []nat.PortBinding{{HostIP: PUBLISH_HOST_IP}}
+	}
+	return exposed, bindings
+}
+
+// CreatePublishNetwork creates the testnet's publish network, unless it exists. Unlike the testnet network it isn't
+// internal, which Docker needs to publish ports. Docker picks its subnet. It returns the network name.
+func CreatePublishNetwork(cli *client.Client, ctx context.Context, ref TestnetRef) (string, error) {
+	name := ref.PublishNetwork()
+	networks, err := cli.NetworkList(ctx, network.ListOptions{Filters: filters.NewArgs(filters.Arg("name", name))})
+	if err != nil {
+		log.WithError(err).Error("Failed to list Docker networks")
+		return "", err
+	}
+	for _, existing := range networks {
+		if existing.Name == name {
+			log.WithField("networkName", name).Debug("Publish network already exists, using existing network")
+			return name, nil
+		}
+	}
+	log.WithField("networkName", name).Debug("Creating publish network")
+	if _, err := cli.NetworkCreate(ctx, name, network.CreateOptions{
+		Driver: "bridge",
+		Labels: ref.Labels(ROLE_NETWORK),
+	}); err != nil {
+		log.WithError(err).Error("Failed to create publish network")
+		return "", fmt.Errorf("error creating network %s: %v", name, err)
+	}
+	return name, nil
+}
+
+// IsolateContainer removes the default route of a running container attached to the publish network, and its route
+// to the other containers on it. Docker adds them again whenever the container starts.
+func IsolateContainer(cli *client.Client, ctx context.Context, ref TestnetRef, containerID string) error {
+	info, err := cli.NetworkInspect(ctx, ref.PublishNetwork(), network.InspectOptions{})
+	if err != nil {
+		return fmt.Errorf("error inspecting network %s: %v", ref.PublishNetwork(), err)
+	}
+	var subnet, gateway string
+	for _, config := range info.IPAM.Config {
+		if prefix, err := netip.ParsePrefix(config.Subnet); err == nil && prefix.Addr().Is4() {
+			subnet, gateway = config.Subnet, config.Gateway
+		}
+	}
+	if subnet == "" || gateway == "" {
+		return fmt.Errorf("network %s has no IPv4 subnet and gateway", ref.PublishNetwork())
+	}
+	cmd := []string{"sh", "-c", isolateScript, "sh", subnet, gateway}
+	if _, err := RunSidecar(cli, ctx, ref, containerID, NETEM_IMAGE, cmd); err != nil {
+		return fmt.Errorf("error isolating %s on %s: %v", containerID, ref.PublishNetwork(), err)
+	}
+	log.WithField("containerID", containerID).Debug("Isolated published container")
+	return nil
+}
+
+// PublishedPorts returns the host addresses the published TCP ports of a container are reachable on, keyed by the
+// port inside the container. A container that isn't running has none.
+func PublishedPorts(cli *client.Client, ctx context.Context, containerID string) (map[int]string, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("error inspecting container %s: %v", containerID, err)
+	}
+	ports := map[int]string{}
+	if info.NetworkSettings == nil {
+		return ports, nil
+	}
+	for port, bindings := range info.NetworkSettings.Ports {
+		if port.Proto() != "tcp" || len(bindings) == 0 {
+			continue
+		}
+		for _, b := range bindings {
+			// Prefer the IPv4 binding, Docker may list an IPv6 one as well
+			if _, done := ports[port.Int()]; !done || net.ParseIP(b.HostIP).To4() != nil {
+				ports[port.Int()] = net.JoinHostPort(b.HostIP, b.HostPort)
+			}
+		}
+	}
+	return ports, nil
+}
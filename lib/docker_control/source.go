@@ -0,0 +1,198 @@
+package docker_control
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/dockerfiles"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// SOURCE_DIR is where a local checkout is placed in the build context, next to the Dockerfile
+	SOURCE_DIR = "src"
+	// LABEL_COMMIT holds the commit an image was built from
+	LABEL_COMMIT = "org.go-i2p.testnet.commit"
+	// LABEL_DIRTY is "true" when an image was built from a checkout with uncommitted changes
+	LABEL_DIRTY = "org.go-i2p.testnet.dirty"
+)
+
+// SourceVersion describes the state of a git checkout
+type SourceVersion struct {
+	Commit string
+	Dirty  bool
+}
+
+// Tag returns the image tag for the checkout: its short commit hash, with "-dirty" appended if it has uncommitted changes
+func (v SourceVersion) Tag() string {
+	if v.Dirty {
+		return v.Commit + "-dirty"
+	}
+	return v.Commit
+}
+
+// git runs a git command in dir and returns its output
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// GetSourceVersion returns the commit and dirty state of the git checkout in dir
+func GetSourceVersion(dir string) (SourceVersion, error) {
+	commit, err := git(dir, "rev-parse", "--short=12", "HEAD")
+	if err != nil {
+		return SourceVersion{}, fmt.Errorf("error reading commit of %s: %v", dir, err)
+	}
+	status, err := git(dir, "status", "--porcelain")
+	if err != nil {
+		return SourceVersion{}, fmt.Errorf("error reading status of %s: %v", dir, err)
+	}
+	return SourceVersion{
+		Commit: strings.TrimSpace(string(commit)),
+		Dirty:  len(bytes.TrimSpace(status)) > 0,
+	}, nil
+}
+
+// sourceFiles lists the files of the checkout in dir that git does not ignore, tracked or not
+func sourceFiles(dir string) ([]string, error) {
+	out, err := git(dir, "ls-files", "--cached", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("error listing files of %s: %v", dir, err)
+	}
+	var files []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(string(out), "\x00") {
+		// Files with unmerged changes are listed once per stage
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// addContextFile adds the file name under dir to a build context as archiveName
+func addContextFile(tw *tar.Writer, dir string, name string, archiveName string) error {
+	fullPath := filepath.Join(dir, filepath.FromSlash(name))
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		// Deleted in the working tree but not yet in the index
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link := ""
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if link, err = os.Readlink(fullPath); err != nil {
+			return err
+		}
+	case info.IsDir():
+		// A submodule; its files belong to another checkout
+		log.WithField("path", name).Warn("Skipping submodule in source checkout")
+		return nil
+	case !info.Mode().IsRegular():
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = archiveName
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// BuildDockerImageFromSource builds an image from the embedded Dockerfile with the git checkout in srcDir
+// as its build context. Files git ignores are left out. The image is tagged imageName:latest and with the
+// checkout's version, which is returned.
+func BuildDockerImageFromSource(cli *client.Client, ctx context.Context, imageName string, dockerfileName string, srcDir string) (SourceVersion, error) {
+	log.WithFields(map[string]interface{}{
+		"imageName":      imageName,
+		"dockerfileName": dockerfileName,
+		"srcDir":         srcDir,
+	}).Debug("Starting Docker image build from local source")
+
+	version, err := GetSourceVersion(srcDir)
+	if err != nil {
+		log.WithError(err).Error("Failed to read source version")
+		return SourceVersion{}, err
+	}
+	files, err := sourceFiles(srcDir)
+	if err != nil {
+		log.WithError(err).Error("Failed to list source files")
+		return SourceVersion{}, err
+	}
+
+	dockerfileContent, err := dockerfiles.GetDockerfileContent(dockerfileName)
+	if err != nil {
+		log.WithError(err).Errorf("Failed to get embedded Dockerfile: %s", dockerfileName)
+		return SourceVersion{}, fmt.Errorf("error retrieving Dockerfile %s: %v", dockerfileName, err)
+	}
+
+	log.WithField("files", len(files)).Debug("Creating build context from source checkout")
+	tarBuffer := new(bytes.Buffer)
+	tw := tar.NewWriter(tarBuffer)
+	if err := writeDockerfile(tw, dockerfileContent); err != nil {
+		tw.Close()
+		return SourceVersion{}, err
+	}
+	for _, name := range files {
+		if err := addContextFile(tw, srcDir, name, path.Join(SOURCE_DIR, name)); err != nil {
+			tw.Close()
+			log.WithFields(map[string]interface{}{
+				"path":  name,
+				"error": err,
+			}).Error("Failed to add source file to build context")
+			return SourceVersion{}, fmt.Errorf("error adding %s to build context: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		log.WithError(err).Error("Failed to close tar writer")
+		return SourceVersion{}, fmt.Errorf("error closing tar writer: %v", err)
+	}
+
+	hash, err := contextHash(tarBuffer.Bytes(), "Dockerfile", nil)
+	if err != nil {
+		return SourceVersion{}, err
+	}
+	tags := []string{imageName + ":latest", imageName + ":" + version.Tag()}
+	labels := map[string]string{
+		LABEL_COMMIT:       version.Commit,
+		LABEL_DIRTY:        fmt.Sprint(version.Dirty),
+		LABEL_VERSION:      version.Tag(),
+		LABEL_CONTEXT_HASH: hash,
+	}
+	if err := runImageBuild(cli, ctx, tarBuffer, "Dockerfile", tags, nil, labels); err != nil {
+		return SourceVersion{}, err
+	}
+	return version, nil
+}
@@ -0,0 +1,135 @@
+package docker_control
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// gitCheckout creates a git repository in a temporary directory with the given files committed
+func gitCheckout(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		if _, err := git(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// writeFiles writes files, keyed by their slash separated path, below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSourceVersionTag(t *testing.T) {
+	if tag := (SourceVersion{Commit: "0123456789ab"}).Tag(); tag != "0123456789ab" {
+		t.Errorf("Tag() = %q, want the commit", tag)
+	}
+	if tag := (SourceVersion{Commit: "0123456789ab", Dirty: true}).Tag(); tag != "0123456789ab-dirty" {
+		t.Errorf("Tag() of a dirty checkout = %q, want 0123456789ab-dirty", tag)
+	}
+}
+
+func TestGetSourceVersion(t *testing.T) {
+	dir := gitCheckout(t, map[string]string{"main.go": "package main\n", ".gitignore": "*.out\n"})
+	version, err := GetSourceVersion(dir)
+	if err != nil {
+		t.Fatalf("GetSourceVersion() = %v", err)
+	}
+	if len(version.Commit) != 12 || version.Dirty {
+		t.Errorf("GetSourceVersion() = %+v, want a clean checkout at a 12 character commit", version)
+	}
+
+	// Ignored files don't make a checkout dirty, untracked ones do
+	writeFiles(t, dir, map[string]string{"router.out": "binary"})
+	if version, _ := GetSourceVersion(dir); version.Dirty {
+		t.Errorf("GetSourceVersion() is dirty with only an ignored file")
+	}
+	writeFiles(t, dir, map[string]string{"new.go": "package main\n"})
+	if version, _ := GetSourceVersion(dir); !version.Dirty {
+		t.Errorf("GetSourceVersion() is clean with an untracked file")
+	}
+
+	if _, err := GetSourceVersion(t.TempDir()); err == nil {
+		t.Errorf("GetSourceVersion() of a directory that isn't a checkout succeeded")
+	}
+}
+
+func TestSourceFiles(t *testing.T) {
+	dir := gitCheckout(t, map[string]string{"main.go": "package main\n", "lib/a.go": "package lib\n", ".gitignore": "*.out\n"})
+	writeFiles(t, dir, map[string]string{"router.out": "binary", "lib/b.go": "package lib\n"})
+
+	files, err := sourceFiles(dir)
+	if err != nil {
+		t.Fatalf("sourceFiles() = %v", err)
+	}
+	sort.Strings(files)
+	want := []string{".gitignore", "lib/a.go", "lib/b.go", "main.go"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("sourceFiles() = %q, want %q", files, want)
+	}
+}
+
+func TestAddContextFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"lib/a.go": "package lib\n"})
+	if err := os.Symlink("a.go", filepath.Join(dir, "lib", "link.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	// A file deleted from the working tree is left out
+	for _, name := range []string{"lib/a.go", "lib/link.go", "lib/deleted.go"} {
+		if err := addContextFile(tw, dir, name, path.Join(SOURCE_DIR, name)); err != nil {
+			t.Fatalf("addContextFile(%s) = %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(&buf)
+	var entries []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		entries = append(entries, hdr.Name+"|"+hdr.Linkname+"|"+string(content))
+	}
+	want := []string{"src/lib/a.go||package lib\n", "src/lib/link.go|a.go|"}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("build context holds %q, want %q", entries, want)
+	}
+}
@@ -0,0 +1,46 @@
+package docker_control
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DEFAULT_TESTNET is the name used when no testnet name is given
+const DEFAULT_TESTNET = "go-i2p-testnet"
+
+var testnetNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// TestnetRef identifies a testnet and derives the names and labels of its Docker resources,
+// so that several testnets can share one Docker host without colliding
+type TestnetRef struct {
+	ID   string
+	Name string
+}
+
+// ValidateTestnetName checks that name can be used as a prefix for Docker resource names
+func ValidateTestnetName(name string) error {
+	if !testnetNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid testnet name %q, use letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// NetworkName returns the name of the testnet's Docker network
+func (t TestnetRef) NetworkName() string {
+	return t.Name
+}
+
+// SharedVolume returns the name of the volume shared by all routers of the testnet
+func (t TestnetRef) SharedVolume() string {
+	return t.Name + "-shared"
+}
+
+// PublishNetwork returns the name of the network routers publishing their services on host ports are attached to
+func (t TestnetRef) PublishNetwork() string {
+	return t.Name + "-publish"
+}
+
+// ResourceName prefixes a container or volume name with the testnet name
+func (t TestnetRef) ResourceName(name string) string {
+	return t.Name + "-" + name
+}
@@ -1,36 +1,104 @@
 package docker_control
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"io"
+	"path"
+	"sort"
+	"strings"
 )
 
-const SHARED_VOLUME = "go-i2p-testnet-shared"
+// HELPER_IMAGE is the image of the containers OpenVolume creates to access volumes
+const HELPER_IMAGE = "alpine:latest"
 
-func CreateSharedVolume(cli *client.Client, ctx context.Context) (string, error) {
-	//volumeName := "go-i2p-shared"
+// PullHelperImage pulls HELPER_IMAGE unless it is already there, e.g. loaded from an image bundle
+func PullHelperImage(cli *client.Client, ctx context.Context) error {
+	return PullDockerImage(cli, ctx, HELPER_IMAGE)
+}
+
+func CreateSharedVolume(cli *client.Client, ctx context.Context, ref TestnetRef) (string, error) {
+	volumeName := ref.SharedVolume()
 
-	log.WithField("volumeName", SHARED_VOLUME).Debug("Starting Docker volume creation")
+	log.WithField("volumeName", volumeName).Debug("Starting Docker volume creation")
 
 	createOptions := volume.CreateOptions{
-		Name: SHARED_VOLUME,
+		Name:   volumeName,
+		Labels: ref.Labels(ROLE_SHARED),
 	}
 
 	log.WithFields(map[string]interface{}{
-		"volumeName": SHARED_VOLUME,
+		"volumeName": volumeName,
 		"options":    createOptions,
 	}).Debug("Creating Docker volume")
 
 	_, err := cli.VolumeCreate(ctx, createOptions)
 	if err != nil {
 		log.WithFields(map[string]interface{}{
-			"volumeName": SHARED_VOLUME,
+			"volumeName": volumeName,
 			"error":      err,
 		}).Error("Failed to create Docker volume")
 		return "", fmt.Errorf("error creating shared volume: %v", err)
 	}
-	log.WithField("volumeName", SHARED_VOLUME).Debug("Successfully created shared Docker volume")
-	return SHARED_VOLUME, nil
+	log.WithField("volumeName", volumeName).Debug("Successfully created shared Docker volume")
+	return volumeName, nil
+}
+
+// TarFiles packs files, keyed by their path relative to root, into a tar archive of absolute paths in a stable order.
+// Every directory from root down to the files gets an entry of its own, so extracting the archive with
+// CopyToContainerOptions.CopyUIDGID gives the directories to the container's user as well, instead of Docker
+// creating them for root.
+func TarFiles(root string, files map[string][]byte) (io.Reader, error) {
+	root = path.Clean("/" + root)
+	contents := make(map[string][]byte, len(files))
+	dirs := map[string]bool{}
+	for name, content := range files {
+		name = path.Join(root, name)
+		contents[name] = content
+		for dir := path.Dir(name); dir != "/" && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			if dir == root {
+				break
+			}
+		}
+	}
+	names := make([]string, 0, len(contents)+len(dirs))
+	for name := range contents {
+		names = append(names, name)
+	}
+	for dir := range dirs {
+		names = append(names, dir+"/")
+	}
+	// Sorted, a directory comes before everything in it
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, name := range names {
+		hdr := &tar.Header{Name: strings.TrimPrefix(name, "/")}
+		var content []byte
+		if strings.HasSuffix(name, "/") {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Mode = 0755
+		} else {
+			content = contents[name]
+			hdr.Typeflag = tar.TypeReg
+			hdr.Mode = 0644
+			hdr.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, fmt.Errorf("error writing tar header for %s: %v", name, err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, fmt.Errorf("error writing %s to tar: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("error closing tar writer: %v", err)
+	}
+	return buf, nil
 }
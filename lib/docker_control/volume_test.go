@@ -0,0 +1,47 @@
+package docker_control
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestTarFiles(t *testing.T) {
+	archive, err := TarFiles("/root/.i2pd/", map[string][]byte{
+		"netDb/r1/routerInfo-a.dat": []byte("a"),
+		"netDb/r2/routerInfo-b.dat": []byte("bb"),
+		"i2pd.conf":                 []byte("conf"),
+	})
+	if err != nil {
+		t.Fatalf("TarFiles() = %v", err)
+	}
+
+	tr := tar.NewReader(archive)
+	var entries []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		entries = append(entries, fmt.Sprintf("%s|%c|%o|%s", hdr.Name, hdr.Typeflag, hdr.Mode, content))
+	}
+	// The root's parents already exist and keep their owner, / never gets an entry
+	want := []string{
+		"root/.i2pd/|5|755|",
+		"root/.i2pd/i2pd.conf|0|644|conf",
+		"root/.i2pd/netDb/|5|755|",
+		"root/.i2pd/netDb/r1/|5|755|",
+		"root/.i2pd/netDb/r1/routerInfo-a.dat|0|644|a",
+		"root/.i2pd/netDb/r2/|5|755|",
+		"root/.i2pd/netDb/r2/routerInfo-b.dat|0|644|bb",
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("TarFiles() holds %q, want %q", entries, want)
+	}
+}
@@ -0,0 +1,258 @@
+package docker_control
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VOLUME_DIR is where OpenVolume mounts the volume in its helper container
+const VOLUME_DIR = "/volume"
+
+// FS reads, writes and lists the files below a directory of a container through the archive API.
+// The container doesn't have to be running: Docker mounts the volumes of a container that was only
+// created for the archive API as well, so FS works on stopped routers and on never-started helpers.
+type FS struct {
+	cli         *client.Client
+	containerID string
+	root        string
+	// helper is set when the container was created by OpenVolume, Close removes it
+	helper bool
+}
+
+// FileInfo describes a file or directory listed by FS.List
+type FileInfo struct {
+	// Path is relative to the listed directory
+	Path    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+}
+
+// ContainerFS accesses the files below root in a container, e.g. a router's data dir
+func ContainerFS(cli *client.Client, containerID string, root string) *FS {
+	return &FS{cli: cli, containerID: containerID, root: path.Clean("/" + root)}
+}
+
+// OpenVolume accesses the files of a named volume. The volume is mounted in a helper container that is
+// created but never started, so nothing runs and helpers of concurrent calls don't collide. Close removes it.
+func OpenVolume(cli *client.Client, ctx context.Context, ref TestnetRef, volumeName string) (*FS, error) {
+	config := &container.Config{
+		Image:  HELPER_IMAGE,
+		Labels: ref.Labels(ROLE_HELPER),
+	}
+	hostConfig := &container.HostConfig{
+		Binds: []string{volumeName + ":" + VOLUME_DIR},
+	}
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if client.IsErrNotFound(err) {
+		// The helper image is pulled when a testnet starts, but it may have been removed since
+		if err = PullHelperImage(cli, ctx); err == nil {
+			resp, err = cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+		}
+	}
+	if err != nil {
+		log.WithFields(map[string]interface{}{
+			"volumeName": volumeName,
+			"error":      err,
+		}).Error("Failed to create helper container")
+		return nil, fmt.Errorf("error creating helper container for volume %s: %v", volumeName, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"volumeName":  volumeName,
+		"containerID": resp.ID,
+	}).Debug("Opened volume")
+	return &FS{cli: cli, containerID: resp.ID, root: VOLUME_DIR, helper: true}, nil
+}
+
+// Close removes the helper container of a volume opened with OpenVolume, the volume itself is kept
+func (f *FS) Close(ctx context.Context) error {
+	if !f.helper {
+		return nil
+	}
+	if err := f.cli.ContainerRemove(ctx, f.containerID, container.RemoveOptions{Force: true}); err != nil {
+		log.WithFields(map[string]interface{}{
+			"containerID": f.containerID,
+			"error":       err,
+		}).Error("Failed to remove helper container")
+		return fmt.Errorf("error removing helper container: %v", err)
+	}
+	return nil
+}
+
+// path returns the path of name, relative to the root, in the container
+func (f *FS) path(name string) string {
+	return path.Join(f.root, name)
+}
+
+// WriteFiles writes files, keyed by their path relative to the root. Missing directories are created. The files and
+// the directories from the root down to them belong to the user the container runs as, so a router that doesn't run
+// as root can still write to them, e.g. to the netDb directories it is given RouterInfos in.
+func (f *FS) WriteFiles(ctx context.Context, files map[string][]byte) error {
+	if len(files) == 0 {
+		return nil
+	}
+	// Extracting at / with full paths has Docker create the root too, e.g. a netDb the router hasn't created yet
+	archive, err := TarFiles(f.root, files)
+	if err != nil {
+		return err
+	}
+	options := container.CopyToContainerOptions{CopyUIDGID: true}
+	if err := f.cli.CopyToContainer(ctx, f.containerID, "/", archive, options); err != nil {
+		return fmt.Errorf("error writing files to %s: %v", f.root, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"containerID": f.containerID,
+		"root":        f.root,
+		"files":       len(files),
+	}).Debug("Wrote files to container")
+	return nil
+}
+
+// walk calls fn for every entry below dir, relative to the root, with its path relative to dir.
+// Entries are read straight from the archive, fn has to read a file's content before returning.
+func (f *FS) walk(ctx context.Context, dir string, fn func(name string, hdr *tar.Header, content io.Reader) error) error {
+	fullPath := f.path(dir)
+	reader, _, err := f.cli.CopyFromContainer(ctx, f.containerID, fullPath)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return fmt.Errorf("%s: %w", fullPath, os.ErrNotExist)
+		}
+		return fmt.Errorf("error copying %s from container: %v", fullPath, err)
+	}
+	defer reader.Close()
+
+	// Entries are named after the copied directory or file itself, e.g. netDb/r1/routerInfo-....dat
+	base := path.Base(fullPath)
+	tarReader := tar.NewReader(reader)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s from container: %v", fullPath, err)
+		}
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if name == base {
+			name = "."
+		} else if !strings.HasPrefix(name, base+"/") {
+			continue
+		} else {
+			name = strings.TrimPrefix(name, base+"/")
+		}
+		if err := fn(name, hdr, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadFile returns the content of a file, relative to the root. A missing file gives an error wrapping os.ErrNotExist.
+func (f *FS) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	var content []byte
+	found := false
+	err := f.walk(ctx, name, func(entry string, hdr *tar.Header, r io.Reader) error {
+		if entry != "." || hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		found = true
+		var err error
+		content, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not a regular file", f.path(name))
+	}
+	return content, nil
+}
+
+// ReadDir returns every regular file below dir, relative to the root, keyed by its path relative to dir
+func (f *FS) ReadDir(ctx context.Context, dir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := f.walk(ctx, dir, func(name string, hdr *tar.Header, r io.Reader) error {
+		if name == "." || hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("error extracting %s: %v", name, err)
+		}
+		files[name] = content
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.WithFields(map[string]interface{}{
+		"containerID": f.containerID,
+		"dir":         f.path(dir),
+		"files":       len(files),
+	}).Debug("Read directory from container")
+	return files, nil
+}
+
+// List describes every file and directory below dir, relative to the root, sorted by path
+func (f *FS) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	var infos []FileInfo
+	err := f.walk(ctx, dir, func(name string, hdr *tar.Header, r io.Reader) error {
+		if name == "." {
+			return nil
+		}
+		infos = append(infos, FileInfo{
+			Path:    name,
+			Size:    hdr.Size,
+			Mode:    hdr.FileInfo().Mode(),
+			ModTime: hdr.ModTime,
+			IsDir:   hdr.Typeflag == tar.TypeDir,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos, nil
+}
+
+// Exists reports whether a file or directory exists, relative to the root
+func (f *FS) Exists(ctx context.Context, name string) (bool, error) {
+	if _, err := f.cli.ContainerStatPath(ctx, f.containerID, f.path(name)); err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking %s in container: %v", f.path(name), err)
+	}
+	return true, nil
+}
+
+// WriteVolumeFiles writes files into a named volume, keyed by their path relative to the volume's root
+func WriteVolumeFiles(cli *client.Client, ctx context.Context, ref TestnetRef, volumeName string, files map[string][]byte) error {
+	fs, err := OpenVolume(cli, ctx, ref, volumeName)
+	if err != nil {
+		return err
+	}
+	defer fs.Close(ctx)
+	return fs.WriteFiles(ctx, files)
+}
+
+// ReadVolumeDir returns every regular file below dir in a named volume, keyed by its path relative to dir
+func ReadVolumeDir(cli *client.Client, ctx context.Context, ref TestnetRef, volumeName string, dir string) (map[string][]byte, error) {
+	fs, err := OpenVolume(cli, ctx, ref, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.Close(ctx)
+	return fs.ReadDir(ctx, dir)
+}
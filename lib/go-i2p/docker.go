@@ -7,28 +7,53 @@ import (
 	"go-i2p-testnet/lib/docker_control"
 )
 
-func BuildImage(cli *client.Client, ctx context.Context) error {
+// BuildImage builds the go-i2p node image at a version, VERSION_LATEST or empty for the default one
+func BuildImage(cli *client.Client, ctx context.Context, version string) error {
+	image := docker_control.GoI2PNode.Image(version)
 	log.WithFields(map[string]interface{}{
-		"imageName":  docker_control.GoI2PNode.ImageName,
-		"dockerfile": docker_control.GoI2PNode.DockerfileName,
+		"image":      image,
+		"dockerfile": docker_control.GoI2PNode.Dockerfile(version),
 	}).Debug("Starting Docker image build")
-	err := docker_control.BuildDockerImage(cli, ctx, docker_control.GoI2PNode.ImageName, docker_control.GoI2PNode.DockerfileName)
+	err := docker_control.BuildNodeImage(cli, ctx, docker_control.GoI2PNode, version)
 	if err != nil {
 		log.WithFields(map[string]interface{}{
-			"imageName":  docker_control.GoI2PNode.ImageName,
-			"dockerfile": docker_control.GoI2PNode.DockerfileName,
+			"image":      image,
+			"dockerfile": docker_control.GoI2PNode.Dockerfile(version),
 			"error":      err,
 		}).Error("Failed to build Docker image")
-		return fmt.Errorf("error building Docker image: %v", err)
+		return fmt.Errorf("error building Docker image %s: %v", image, err)
 	}
 
-	log.WithField("imageName", docker_control.GoI2PNode.ImageName).Debug("Successfully built Docker image")
+	log.WithField("image", image).Debug("Successfully built Docker image")
 	return nil
 }
 
+// BuildImageFromSource builds the go-i2p node image from the local go-i2p checkout in srcDir.
+// The image is tagged with the checkout's commit and dirty state, which is returned as well.
+func BuildImageFromSource(cli *client.Client, ctx context.Context, srcDir string) (string, error) {
+	log.WithFields(map[string]interface{}{
+		"imageName":  docker_control.GoI2PNode.ImageName,
+		"dockerfile": docker_control.GoI2PNode.SourceDockerfileName,
+		"srcDir":     srcDir,
+	}).Debug("Starting Docker image build from local source")
+	version, err := docker_control.BuildDockerImageFromSource(cli, ctx, docker_control.GoI2PNode.ImageName, docker_control.GoI2PNode.SourceDockerfileName, srcDir)
+	if err != nil {
+		log.WithFields(map[string]interface{}{
+			"imageName": docker_control.GoI2PNode.ImageName,
+			"srcDir":    srcDir,
+			"error":     err,
+		}).Error("Failed to build Docker image from source")
+		return "", fmt.Errorf("error building Docker image from %s: %v", srcDir, err)
+	}
+
+	tag := docker_control.GoI2PNode.ImageName + ":" + version.Tag()
+	log.WithField("image", tag).Debug("Successfully built Docker image from source")
+	return tag, nil
+}
+
 func RemoveImage(cli *client.Client, ctx context.Context) error {
 	log.WithField("imageName", docker_control.GoI2PNode.ImageName).Debug("Starting Docker image removal")
-	err := docker_control.RemoveDockerImage(cli, ctx, "go-i2p-node")
+	err := docker_control.RemoveRepositoryImages(cli, ctx, docker_control.GoI2PNode.ImageName)
 	if err != nil {
 		log.WithFields(map[string]interface{}{
 			"imageName": docker_control.GoI2PNode.ImageName,
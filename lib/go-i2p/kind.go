@@ -0,0 +1,83 @@
+package go_i2p
+
+import (
+	"context"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/topology"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// STOP_SIGNAL makes go-i2p shut down cleanly
+	STOP_SIGNAL = "SIGTERM"
+	// STOP_TIMEOUT is how many seconds go-i2p gets to shut down before it is killed
+	STOP_TIMEOUT = 10
+	// DATA_DIR is where go-i2p looks for config.yaml
+	DATA_DIR = "/root/.go-i2p"
+	// NETDB_DIR is the netDb path written to the config
+	NETDB_DIR = DATA_DIR + "/netDb"
+)
+
+func init() {
+	nodekind.MustRegister(Kind{})
+}
+
+// Kind runs go-i2p routers
+type Kind struct{}
+
+func (Kind) Name() string      { return topology.KindGoI2P }
+func (Kind) Aliases() []string { return []string{"go-i2p", "go_i2p"} }
+
+func (Kind) Image(version string) string { return docker_control.GoI2PNode.Image(version) }
+func (Kind) BuildImage(cli *client.Client, ctx context.Context, version string) error {
+	return BuildImage(cli, ctx, version)
+}
+func (Kind) BuildImageFromSource(cli *client.Client, ctx context.Context, srcDir string) (string, error) {
+	return BuildImageFromSource(cli, ctx, srcDir)
+}
+func (Kind) RemoveImage(cli *client.Client, ctx context.Context) error {
+	return RemoveImage(cli, ctx)
+}
+
+func (Kind) DataDir() string { return DATA_DIR }
+
+// RouterInfoPath is empty, go-i2p does not write its RouterInfo to disk yet
+func (Kind) RouterInfoPath() string { return "" }
+func (Kind) NetDbPath() string      { return NETDB_DIR }
+
+// Config returns the router's config.yaml
+func (Kind) Config(r nodekind.Router) ([]nodekind.File, error) {
+	if r.Floodfill {
+		log.WithField("routerID", r.ID).Warn("go-i2p has no floodfill support yet, starting as a regular router")
+	}
+	return []nodekind.File{{Path: "config.yaml", Content: GenerateRouterConfig(r.ID)}}, nil
+}
+
+func (Kind) ContainerSpec(r nodekind.Router) nodekind.ContainerSpec {
+	return nodekind.ContainerSpec{
+		Cmd:         []string{"go-i2p"},
+		StopSignal:  STOP_SIGNAL,
+		StopTimeout: STOP_TIMEOUT,
+	}
+}
+
+// Probes is empty: go-i2p has no console yet and does not write its RouterInfo to disk, so the running container is all there is to check
+func (Kind) Probes() []nodekind.Probe { return nil }
+
+// logLine matches logrus' text format, e.g. `time="..." level=warning msg="..."`
+var logLine = regexp.MustCompile(`level=(\w+) msg=("(?:[^"\\]|\\.)*"|\S+)`)
+
+func (Kind) ParseLogLine(line string) nodekind.LogEntry {
+	match := logLine.FindStringSubmatch(line)
+	if match == nil {
+		return nodekind.UnparsedLine(line)
+	}
+	msg := match[2]
+	if unquoted, err := strconv.Unquote(msg); err == nil {
+		msg = unquoted
+	}
+	return nodekind.LogEntry{Level: nodekind.NormalizeLevel(match[1]), Message: msg, Line: line}
+}
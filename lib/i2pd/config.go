@@ -2,13 +2,9 @@ package i2pd
 
 import (
 	"bytes"
-	"context"
-	"fmt"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/topology"
 	"gopkg.in/ini.v1"
-
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"go-i2p-testnet/lib/utils"
 )
 
 // I2PDConfig represents the complete i2pd configuration
@@ -447,15 +443,47 @@ func GenerateDefaultI2PDConfig() *I2PDConfig {
 	}
 }
 
-func GenerateRouterConfig(routerID int) (string, error) {
-	log.WithField("routerID", routerID).Debug("Starting i2pd router config generation")
+// GenerateRouterConfig returns the i2pd.conf of a router that binds its transports to address4 and address6.
+// An empty address disables that address family. nat is the kind of NAT the router is behind, empty if none.
+// exposeServices binds the console, proxies, SAM, I2CP and I2PControl to every interface so they can be published.
+// transports tells which of NTCP2 and SSU2 are enabled and published.
+func GenerateRouterConfig(routerID int, floodfill bool, address4 string, address6 string, nat string, exposeServices bool, transports nodekind.Transports) (string, error) {
+	log.WithFields(map[string]interface{}{
+		"routerID":       routerID,
+		"floodfill":      floodfill,
+		"address4":       address4,
+		"address6":       address6,
+		"nat":            nat,
+		"exposeServices": exposeServices,
+		"transports":     transports,
+	}).Debug("Starting i2pd router config generation")
 
 	// Initialize default configuration
 	config := GenerateDefaultI2PDConfig()
 	config.Netid = 5
 	config.ReservedRange = false
-	config.Nat = false
-	config.Floodfill = true
+	config.Floodfill = floodfill
+	config.IPv4 = address4 != ""
+	config.IPv6 = address6 != ""
+	config.Address4 = address4
+	config.Address6 = address6
+	// Behind a NAT the router finds its public address with SSU2 peer tests. A symmetric NAT maps every
+	// connection to another port, so no peer can connect to it over NTCP2.
+	config.Nat = nat != ""
+	config.NTCP2.Enabled = transports.NTCP2.Enabled
+	config.NTCP2.Published = transports.NTCP2.Published && nat != topology.NAT_SYMMETRIC
+	config.SSU2.Enabled = transports.SSU2.Enabled
+	config.SSU2.Published = transports.SSU2.Published
+	if exposeServices {
+		config.HTTP.Address = "0.0.0.0"
+		config.HTTPProxy.Address = "0.0.0.0"
+		config.SocksProxy.Address = "0.0.0.0"
+		config.SAM.Address = "0.0.0.0"
+		config.I2CP.Enabled = true
+		config.I2CP.Address = "0.0.0.0"
+		config.I2PControl.Enabled = true
+		config.I2PControl.Address = "0.0.0.0"
+	}
 
 	// Create an INI file from the struct
 	iniFile := ini.Empty()
@@ -482,92 +510,3 @@ func GenerateRouterConfig(routerID int) (string, error) {
 
 	return configData, nil
 }
-
-func CopyConfigToVolume(cli *client.Client, ctx context.Context, volumeName string, configData string) error {
-	// Create a temporary container to copy data into the volume
-	log.WithField("volumeName", volumeName).Debug("Starting config copy to volume")
-
-	tempContainerConfig := &container.Config{
-		Image:      "alpine",
-		Tty:        false,
-		WorkingDir: "/var/lib/i2pd",
-		Cmd:        []string{"sh", "-c", "mkdir -p /var/lib/i2pd && sleep 1d"},
-	}
-
-	hostConfig := &container.HostConfig{
-		Binds: []string{
-			fmt.Sprintf("%s:/var/lib/i2pd", volumeName),
-		},
-	}
-
-	log.WithFields(map[string]interface{}{
-		"image":      tempContainerConfig.Image,
-		"volumeName": volumeName,
-	}).Debug("Creating temporary container")
-
-	resp, err := cli.ContainerCreate(ctx, tempContainerConfig, hostConfig, nil, nil, "")
-	if err != nil {
-		log.WithError(err).Error("Failed to create temporary container")
-		return fmt.Errorf("error creating temporary container: %v", err)
-	}
-	defer func() {
-		log.WithField("containerID", resp.ID).Debug("Removing temporary container")
-		removeOptions := container.RemoveOptions{Force: true}
-		err := cli.ContainerRemove(ctx, resp.ID, removeOptions)
-		if err != nil {
-			log.WithError(err).Error("Failed to remove temporary container")
-		}
-	}()
-
-	// Start the container
-	log.WithField("containerID", resp.ID).Debug("Starting temporary container")
-	startOptions := container.StartOptions{}
-	if err := cli.ContainerStart(ctx, resp.ID, startOptions); err != nil {
-		log.WithError(err).Error("Failed to start temporary container")
-		return fmt.Errorf("error starting temporary container: %v", err)
-	}
-
-	// Copy the configuration file into the container
-	log.Debug("Creating tar archive of config data")
-	tarReader, err := utils.CreateTarArchive("i2pd.conf", configData)
-	if err != nil {
-		log.WithError(err).Error("Failed to create tar archive")
-		return fmt.Errorf("error creating tar archive: %v", err)
-	}
-
-	// Copy to the container's volume-mounted directory
-	log.WithField("containerID", resp.ID).Debug("Copying config to container")
-	err = cli.CopyToContainer(ctx, resp.ID, "/var/lib/i2pd", tarReader, container.CopyToContainerOptions{})
-	if err != nil {
-		log.WithError(err).Error("Failed to copy config to container")
-		return fmt.Errorf("error copying to container: %v", err)
-	}
-
-	// Optionally, handle additional configuration files like local addressbook
-	/*
-	   localAddrBookData := "your local addressbook content here"
-	   tarReader, err = utils.CreateTarArchive("addressbook/local.csv", localAddrBookData)
-	   if err != nil {
-	       log.WithError(err).Error("Failed to create tar archive for local addressbook")
-	       return fmt.Errorf("error creating tar archive for local addressbook: %v", err)
-	   }
-
-	   log.WithField("containerID", resp.ID).Debug("Copying local addressbook to container")
-	   err = cli.CopyToContainer(ctx, resp.ID, "/var/lib/i2pd/addressbook", tarReader, container.CopyToContainerOptions{})
-	   if err != nil {
-	       log.WithError(err).Error("Failed to copy local addressbook to container")
-	       return fmt.Errorf("error copying local addressbook to container: %v", err)
-	   }
-	*/
-
-	// Stop the container
-	log.WithField("containerID", resp.ID).Debug("Stopping temporary container")
-	stopOptions := container.StopOptions{}
-	if err := cli.ContainerStop(ctx, resp.ID, stopOptions); err != nil {
-		log.WithError(err).Error("Failed to stop temporary container")
-		return fmt.Errorf("error stopping temporary container: %v", err)
-	}
-
-	log.Debug("Successfully copied config to volume")
-	return nil
-}
@@ -7,28 +7,30 @@ import (
 	"go-i2p-testnet/lib/docker_control"
 )
 
-func BuildImage(cli *client.Client, ctx context.Context) error {
+// BuildImage builds the i2pd node image at a version, VERSION_LATEST or empty for the default one
+func BuildImage(cli *client.Client, ctx context.Context, version string) error {
+	image := docker_control.I2PDNode.Image(version)
 	log.WithFields(map[string]interface{}{
-		"imageName":  docker_control.I2PDNode.ImageName,
-		"dockerfile": docker_control.I2PDNode.DockerfileName,
+		"image":      image,
+		"dockerfile": docker_control.I2PDNode.Dockerfile(version),
 	}).Debug("Starting i2pd Docker image build")
-	err := docker_control.BuildDockerImage(cli, ctx, docker_control.I2PDNode.ImageName, docker_control.I2PDNode.DockerfileName)
+	err := docker_control.BuildNodeImage(cli, ctx, docker_control.I2PDNode, version)
 	if err != nil {
 		log.WithFields(map[string]interface{}{
-			"imageName":  docker_control.I2PDNode.ImageName,
-			"dockerfile": docker_control.I2PDNode.DockerfileName,
+			"image":      image,
+			"dockerfile": docker_control.I2PDNode.Dockerfile(version),
 			"error":      err,
 		}).Error("Failed to build i2pd Docker image")
-		return fmt.Errorf("error building i2pd Docker image: %v", err)
+		return fmt.Errorf("error building i2pd Docker image %s: %v", image, err)
 	}
 
-	log.WithField("imageName", docker_control.I2PDNode.ImageName).Debug("Successfully built i2pd Docker image")
+	log.WithField("image", image).Debug("Successfully built i2pd Docker image")
 	return nil
 }
 
 func RemoveImage(cli *client.Client, ctx context.Context) error {
 	log.WithField("imageName", docker_control.I2PDNode.ImageName).Debug("Starting i2pd Docker image removal")
-	err := docker_control.RemoveDockerImage(cli, ctx, docker_control.I2PDNode.ImageName)
+	err := docker_control.RemoveRepositoryImages(cli, ctx, docker_control.I2PDNode.ImageName)
 	if err != nil {
 		log.WithFields(map[string]interface{}{
 			"imageName": docker_control.I2PDNode.ImageName,
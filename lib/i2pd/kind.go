@@ -0,0 +1,141 @@
+package i2pd
+
+import (
+	"context"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/topology"
+	"go-i2p-testnet/lib/utils/logger"
+	"regexp"
+	"strconv"
+)
+
+var log = logger.GetTestnetLogger()
+
+const (
+	// STOP_SIGNAL makes i2pd shut down gracefully, letting its transit tunnels drain first
+	STOP_SIGNAL = "SIGINT"
+	// STOP_TIMEOUT is how many seconds a graceful shutdown may take, i2pd waits up to 10 minutes for transit tunnels
+	STOP_TIMEOUT = 600
+	// DATA_DIR holds i2pd.conf, router.info and the netDb
+	DATA_DIR = "/var/lib/i2pd"
+	// CONSOLE is the address of the web console inside the container
+	CONSOLE = "http://127.0.0.1:7070/"
+)
+
+// The ports of the services i2pd serves besides its transports
+const (
+	CONSOLE_PORT     = 7070
+	HTTP_PROXY_PORT  = 4444
+	SOCKS_PROXY_PORT = 4447
+	SAM_PORT         = 7656
+	I2CP_PORT        = 7654
+	I2PCONTROL_PORT  = 7650
+)
+
+func init() {
+	nodekind.MustRegister(Kind{})
+}
+
+// Kind runs i2pd routers
+type Kind struct{}
+
+func (Kind) Name() string      { return topology.KindI2PD }
+func (Kind) Aliases() []string { return nil }
+
+func (Kind) Image(version string) string { return docker_control.I2PDNode.Image(version) }
+func (Kind) BuildImage(cli *client.Client, ctx context.Context, version string) error {
+	return BuildImage(cli, ctx, version)
+}
+func (Kind) RemoveImage(cli *client.Client, ctx context.Context) error {
+	return RemoveImage(cli, ctx)
+}
+
+func (Kind) DataDir() string        { return DATA_DIR }
+func (Kind) RouterInfoPath() string { return DATA_DIR + "/router.info" }
+func (Kind) NetDbPath() string      { return DATA_DIR + "/netDb" }
+
+// Services are the ports i2pd serves besides its transports, published with the router
+func (Kind) Services() []nodekind.Service {
+	return []nodekind.Service{
+		{Name: nodekind.SERVICE_CONSOLE, Port: CONSOLE_PORT},
+		{Name: nodekind.SERVICE_HTTP_PROXY, Port: HTTP_PROXY_PORT},
+		{Name: nodekind.SERVICE_SOCKS_PROXY, Port: SOCKS_PROXY_PORT},
+		{Name: nodekind.SERVICE_SAM, Port: SAM_PORT},
+		{Name: nodekind.SERVICE_I2CP, Port: I2CP_PORT},
+		{Name: nodekind.SERVICE_I2PCONTROL, Port: I2PCONTROL_PORT},
+	}
+}
+
+// Transports lists the transports an i2pd router can disable or leave unpublished
+func (Kind) Transports() []string {
+	return []string{topology.TRANSPORT_NTCP2, topology.TRANSPORT_SSU2}
+}
+
+// Config returns the router's i2pd.conf, with the address families and transports it uses enabled and NAT detection
+// on behind a NAT
+func (Kind) Config(r nodekind.Router) ([]nodekind.File, error) {
+	var address4, address6 string
+	if r.UsesIPv4() {
+		address4 = r.IP
+	}
+	if r.UsesIPv6() {
+		address6 = r.IPv6
+	}
+	configData, err := GenerateRouterConfig(r.ID, r.Floodfill, address4, address6, r.NAT, r.ExposeServices, r.Transports)
+	if err != nil {
+		return nil, err
+	}
+	return []nodekind.File{{Path: "i2pd.conf", Content: configData}}, nil
+}
+
+// ContainerSpec runs the image's command, which reads the config from DATA_DIR
+func (Kind) ContainerSpec(r nodekind.Router) nodekind.ContainerSpec {
+	return nodekind.ContainerSpec{
+		StopSignal:  STOP_SIGNAL,
+		StopTimeout: STOP_TIMEOUT,
+	}
+}
+
+func (Kind) Probes() []nodekind.Probe {
+	return []nodekind.Probe{
+		{Name: nodekind.PROBE_ROUTER_INFO, Check: nodekind.FileProbe(DATA_DIR + "/router.info")},
+		{Name: nodekind.PROBE_CONSOLE, Check: nodekind.ConsoleProbe(func(r nodekind.Router) string { return CONSOLE })},
+		// Everything else i2pd serves (console, proxies, SAM) is bound to loopback unless it is published
+		{Name: nodekind.PROBE_TRANSPORTS, Check: nodekind.TransportsProbe(0, Kind{}.Services()...)},
+		{Name: nodekind.PROBE_TUNNELS, Optional: true, Check: tunnelsProbe},
+	}
+}
+
+var tunnelSuccess = regexp.MustCompile(`Tunnel creation success rate:</b>\s*(\d+)%`)
+
+// tunnelsProbe checks on the console that i2pd has built at least one tunnel
+func tunnelsProbe(ctx context.Context, cli *client.Client, r nodekind.Router) (bool, string, error) {
+	page, ok, err := nodekind.FetchPage(ctx, cli, r, CONSOLE)
+	if err != nil {
+		return false, "", err
+	}
+	if !ok {
+		return false, "console not answering on " + CONSOLE, nil
+	}
+	match := tunnelSuccess.FindStringSubmatch(page)
+	if match == nil {
+		return false, "tunnel statistics not found on the console", nil
+	}
+	if rate, _ := strconv.Atoi(match[1]); rate == 0 {
+		return false, "no tunnel built yet", nil
+	}
+	return true, "", nil
+}
+
+// logLine matches i2pd's log format, e.g. "14:02:11@517/warn - NetDb: ..."
+var logLine = regexp.MustCompile(`^\S+@\d+/(\w+) - (.*)$`)
+
+func (Kind) ParseLogLine(line string) nodekind.LogEntry {
+	match := logLine.FindStringSubmatch(line)
+	if match == nil {
+		return nodekind.UnparsedLine(line)
+	}
+	return nodekind.LogEntry{Level: nodekind.NormalizeLevel(match[1]), Message: match[2], Line: line}
+}
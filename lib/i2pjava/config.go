@@ -0,0 +1,247 @@
+package i2pjava
+
+import (
+	"fmt"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/topology"
+	"go-i2p-testnet/lib/utils/logger"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var log = logger.GetTestnetLogger()
+
+const (
+	// CONFIG_DIR is where the Java router keeps its configuration, router.info and netDb
+	CONFIG_DIR = "/i2p/.i2p"
+	// NET_ID keeps testnet routers from ever talking to the real network, the same ID the i2pd routers use
+	NET_ID = 5
+	// ROUTER_PORT is the NTCP2 and SSU2 port, every router has an IP of its own so they can all use the same one
+	ROUTER_PORT = 12345
+	// CONSOLE_PORT is the port of the router console
+	CONSOLE_PORT = 7657
+)
+
+// The ports of the services a router publishing them serves besides the console
+const (
+	HTTP_PROXY_PORT  = 4444
+	SOCKS_PROXY_PORT = 4447
+	SAM_PORT         = 7656
+	I2CP_PORT        = 7654
+	// ANY_ADDRESS binds a service to every interface
+	ANY_ADDRESS = "0.0.0.0"
+)
+
+// RouterConfig holds the router.config settings the testnet cares about
+type RouterConfig struct {
+	NetID     int
+	Floodfill bool
+	// Host is the address the router publishes for its transports, empty to let it find its address itself
+	Host string
+	// IPv6 is the router's i2np.ipv6 mode: false, enable or only
+	IPv6           string
+	Port           int
+	ReseedDisabled bool
+	// NTCPAutoIP publishes NTCP2 on the address SSU2 peer testing finds, for a router that publishes no Host
+	NTCPAutoIP bool
+	// I2CPHost is the address the I2CP port listens on, the router's default of loopback if empty
+	I2CPHost string
+	// NTCPDisabled and SSUDisabled turn a transport off, the router neither listens nor connects over it
+	NTCPDisabled bool
+	SSUDisabled  bool
+	// NTCPHidden publishes NTCP2 without an address, so peers can't connect to the router over it
+	NTCPHidden bool
+	// Firewalled makes the router publish SSU2 introducers instead of its own address
+	Firewalled bool
+}
+
+// The i2np.ipv6 modes of the Java router
+const (
+	IPV6_DISABLED = "false"
+	IPV6_ENABLED  = "enable"
+	IPV6_ONLY     = "only"
+)
+
+// Properties renders the configuration as router.config properties
+func (c RouterConfig) Properties() map[string]string {
+	props := map[string]string{
+		"router.networkID":            strconv.Itoa(c.NetID),
+		"router.floodfillParticipant": strconv.FormatBool(c.Floodfill),
+		"router.reseedDisable":        strconv.FormatBool(c.ReseedDisabled),
+		// Testnet addresses are private, which the router refuses to talk to otherwise
+		"i2np.allowLocal":         "true",
+		"i2np.ipv6":               c.IPv6,
+		"i2np.ntcp.port":          strconv.Itoa(c.Port),
+		"i2np.ntcp.autoip":        strconv.FormatBool(c.NTCPAutoIP),
+		"i2np.udp.port":           strconv.Itoa(c.Port),
+		"i2np.udp.internalPort":   strconv.Itoa(c.Port),
+		"i2np.upnp.enable":        "false",
+		"i2np.laptopMode":         "false",
+		"router.blocklist.enable": "false",
+		// There is no NTP server on the internal testnet network
+		"time.disabled":                       "true",
+		"router.newsRefreshFrequency":         "0",
+		"routerconsole.welcomeWizardComplete": "true",
+	}
+	// Without a host the router has to find its address itself
+	if c.Host != "" {
+		if !c.NTCPHidden {
+			props["i2np.ntcp.hostname"] = c.Host
+		}
+		props["i2np.udp.host"] = c.Host
+	}
+	if c.NTCPDisabled {
+		props["i2np.ntcp.enable"] = "false"
+	}
+	if c.SSUDisabled {
+		props["i2np.udp.enable"] = "false"
+	}
+	if c.Firewalled {
+		props["i2np.ipv4.firewalled"] = "true"
+		props["i2np.ipv6.firewalled"] = "true"
+	}
+	if c.I2CPHost != "" {
+		props["i2cp.hostname"] = c.I2CPHost
+		props["i2cp.port"] = strconv.Itoa(I2CP_PORT)
+	}
+	return props
+}
+
+// ClientsConfig holds the clients.config settings: the router console, and SAM and the proxies when they are published
+type ClientsConfig struct {
+	ConsoleHost string
+	ConsolePort int
+	// ServiceHost is the address SAM and the proxies listen on, they aren't started if it is empty
+	ServiceHost string
+}
+
+// Properties renders the configuration as clients.config properties
+func (c ClientsConfig) Properties() map[string]string {
+	props := map[string]string{
+		"clientApp.0.main":        "net.i2p.router.web.RouterConsoleRunner",
+		"clientApp.0.name":        "I2P Router Console",
+		"clientApp.0.args":        fmt.Sprintf("%d %s ./webapps/", c.ConsolePort, c.ConsoleHost),
+		"clientApp.0.delay":       "0",
+		"clientApp.0.startOnLoad": "true",
+	}
+	if c.ServiceHost != "" {
+		props["clientApp.1.main"] = "net.i2p.sam.SAMBridge"
+		props["clientApp.1.name"] = "SAM application bridge"
+		props["clientApp.1.args"] = fmt.Sprintf("sam.keys %s %d i2cp.tcp.host=127.0.0.1 i2cp.tcp.port=%d", c.ServiceHost, SAM_PORT, I2CP_PORT)
+		props["clientApp.1.delay"] = "0"
+		props["clientApp.1.startOnLoad"] = "true"
+		props["clientApp.2.main"] = "net.i2p.i2ptunnel.TunnelControllerGroup"
+		props["clientApp.2.name"] = "Application tunnels"
+		props["clientApp.2.args"] = TUNNEL_CONFIG
+		props["clientApp.2.delay"] = "0"
+		props["clientApp.2.startOnLoad"] = "true"
+	}
+	return props
+}
+
+// TUNNEL_CONFIG is the i2ptunnel config the proxies of a router publishing its services are read from
+const TUNNEL_CONFIG = "i2ptunnel.config"
+
+// GenerateTunnelConfig returns the i2ptunnel.config of the HTTP and SOCKS proxies, listening on host
+func GenerateTunnelConfig(host string) string {
+	props := map[string]string{}
+	for i, proxy := range []struct {
+		name string
+		kind string
+		port int
+	}{
+		{"I2P HTTP Proxy", "httpclient", HTTP_PROXY_PORT},
+		{"I2P SOCKS Proxy", "sockstunnel", SOCKS_PROXY_PORT},
+	} {
+		prefix := fmt.Sprintf("tunnel.%d.", i)
+		props[prefix+"name"] = proxy.name
+		props[prefix+"type"] = proxy.kind
+		props[prefix+"interface"] = host
+		props[prefix+"listenPort"] = strconv.Itoa(proxy.port)
+		props[prefix+"sharedClient"] = "true"
+		props[prefix+"i2cpHost"] = "127.0.0.1"
+		props[prefix+"i2cpPort"] = strconv.Itoa(I2CP_PORT)
+		props[prefix+"startOnLoad"] = "true"
+	}
+	return formatProperties(props)
+}
+
+// formatProperties writes properties as a Java properties file with sorted keys, so configs are stable to diff
+func formatProperties(props map[string]string) string {
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", key, props[key])
+	}
+	return b.String()
+}
+
+// GenerateRouterConfig returns the router.config and clients.config of a Java router listening on ip and ipv6.
+// An empty address disables that address family; with both, the router publishes ip and finds ipv6 itself.
+// nat is the kind of NAT the router is behind, empty if none. exposeServices starts SAM and the proxies and binds
+// them, the console and I2CP to every interface so they can be published. transports tells which of NTCP2 and SSU2
+// are enabled and published.
+func GenerateRouterConfig(routerID int, ip string, ipv6 string, floodfill bool, nat string, exposeServices bool, transports nodekind.Transports) (string, string, error) {
+	log.WithFields(map[string]interface{}{
+		"routerID":       routerID,
+		"ip":             ip,
+		"ipv6":           ipv6,
+		"floodfill":      floodfill,
+		"nat":            nat,
+		"exposeServices": exposeServices,
+		"transports":     transports,
+	}).Debug("Starting Java I2P router config generation")
+	if ip == "" && ipv6 == "" {
+		return "", "", fmt.Errorf("router %d has no IP address", routerID)
+	}
+
+	routerConfig := RouterConfig{
+		NetID:          NET_ID,
+		Floodfill:      floodfill,
+		Host:           ip,
+		IPv6:           IPV6_ENABLED,
+		Port:           ROUTER_PORT,
+		ReseedDisabled: true,
+		NTCPDisabled:   !transports.NTCP2.Enabled,
+		SSUDisabled:    !transports.SSU2.Enabled,
+		NTCPHidden:     !transports.NTCP2.Published,
+		Firewalled:     !transports.SSU2.Published,
+	}
+	switch {
+	case ipv6 == "":
+		routerConfig.IPv6 = IPV6_DISABLED
+	case ip == "":
+		routerConfig.Host = ipv6
+		routerConfig.IPv6 = IPV6_ONLY
+	}
+	// The console listens on the router's own address so it can be probed without going through loopback
+	clientsConfig := ClientsConfig{
+		ConsoleHost: routerConfig.Host,
+		ConsolePort: CONSOLE_PORT,
+	}
+	// Behind a NAT the router's own address is a private one, it finds its public address with SSU2 peer tests.
+	// A symmetric NAT maps every connection to another port, so no peer can connect to it over NTCP2.
+	if nat != "" {
+		routerConfig.Host = ""
+		routerConfig.NTCPAutoIP = transports.NTCP2.Published && nat != topology.NAT_SYMMETRIC
+	}
+	if exposeServices {
+		routerConfig.I2CPHost = ANY_ADDRESS
+		clientsConfig.ConsoleHost = ANY_ADDRESS
+		clientsConfig.ServiceHost = ANY_ADDRESS
+	}
+
+	routerData := formatProperties(routerConfig.Properties())
+	clientsData := formatProperties(clientsConfig.Properties())
+	log.WithFields(map[string]interface{}{
+		"routerID":      routerID,
+		"routerConfig":  routerData,
+		"clientsConfig": clientsData,
+	}).Debug("Java I2P router configuration generated successfully")
+	return routerData, clientsData, nil
+}
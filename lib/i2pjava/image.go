@@ -0,0 +1,44 @@
+package i2pjava
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+)
+
+// BuildImage builds the Java I2P node image at a version, VERSION_LATEST or empty for the default one
+func BuildImage(cli *client.Client, ctx context.Context, version string) error {
+	image := docker_control.I2PJavaNode.Image(version)
+	log.WithFields(map[string]interface{}{
+		"image":      image,
+		"dockerfile": docker_control.I2PJavaNode.Dockerfile(version),
+	}).Debug("Starting Java I2P Docker image build")
+	err := docker_control.BuildNodeImage(cli, ctx, docker_control.I2PJavaNode, version)
+	if err != nil {
+		log.WithFields(map[string]interface{}{
+			"image":      image,
+			"dockerfile": docker_control.I2PJavaNode.Dockerfile(version),
+			"error":      err,
+		}).Error("Failed to build Java I2P Docker image")
+		return fmt.Errorf("error building Java I2P Docker image %s: %v", image, err)
+	}
+
+	log.WithField("image", image).Debug("Successfully built Java I2P Docker image")
+	return nil
+}
+
+func RemoveImage(cli *client.Client, ctx context.Context) error {
+	log.WithField("imageName", docker_control.I2PJavaNode.ImageName).Debug("Starting Java I2P Docker image removal")
+	err := docker_control.RemoveRepositoryImages(cli, ctx, docker_control.I2PJavaNode.ImageName)
+	if err != nil {
+		log.WithFields(map[string]interface{}{
+			"imageName": docker_control.I2PJavaNode.ImageName,
+			"error":     err,
+		}).Error("Failed to remove Java I2P Docker image")
+		return fmt.Errorf("error removing Java I2P Docker image: %v", err)
+	}
+
+	log.WithField("imageName", docker_control.I2PJavaNode.ImageName).Debug("Successfully removed Java I2P Docker image")
+	return nil
+}
@@ -0,0 +1,139 @@
+package i2pjava
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/topology"
+	"net"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// STOP_SIGNAL runs the Java router's shutdown hook
+	STOP_SIGNAL = "SIGTERM"
+	// STOP_TIMEOUT is how many seconds the router gets to save its state before it is killed
+	STOP_TIMEOUT = 60
+)
+
+func init() {
+	nodekind.MustRegister(Kind{})
+}
+
+// Kind runs the reference Java I2P router
+type Kind struct{}
+
+func (Kind) Name() string      { return topology.KindJava }
+func (Kind) Aliases() []string { return []string{"i2p-java", "i2p_java", "i2pjava"} }
+
+func (Kind) Image(version string) string { return docker_control.I2PJavaNode.Image(version) }
+func (Kind) BuildImage(cli *client.Client, ctx context.Context, version string) error {
+	return BuildImage(cli, ctx, version)
+}
+func (Kind) RemoveImage(cli *client.Client, ctx context.Context) error {
+	return RemoveImage(cli, ctx)
+}
+
+func (Kind) DataDir() string        { return CONFIG_DIR }
+func (Kind) RouterInfoPath() string { return CONFIG_DIR + "/router.info" }
+func (Kind) NetDbPath() string      { return CONFIG_DIR + "/netDb" }
+
+// Transports lists the transports a Java router can disable or leave unpublished
+func (Kind) Transports() []string {
+	return []string{topology.TRANSPORT_NTCP2, topology.TRANSPORT_SSU2}
+}
+
+// Config returns the router's router.config and clients.config
+func (Kind) Config(r nodekind.Router) ([]nodekind.File, error) {
+	var ip, ipv6 string
+	if r.UsesIPv4() {
+		ip = r.IP
+	}
+	if r.UsesIPv6() {
+		ipv6 = r.IPv6
+	}
+	routerConfig, clientsConfig, err := GenerateRouterConfig(r.ID, ip, ipv6, r.Floodfill, r.NAT, r.ExposeServices, r.Transports)
+	if err != nil {
+		return nil, err
+	}
+	files := []nodekind.File{
+		{Path: "router.config", Content: routerConfig},
+		{Path: "clients.config", Content: clientsConfig},
+	}
+	if r.ExposeServices {
+		files = append(files, nodekind.File{Path: TUNNEL_CONFIG, Content: GenerateTunnelConfig(ANY_ADDRESS)})
+	}
+	return files, nil
+}
+
+// Services are the ports a router publishing its services serves besides its transports
+func (Kind) Services() []nodekind.Service {
+	return []nodekind.Service{
+		{Name: nodekind.SERVICE_CONSOLE, Port: CONSOLE_PORT},
+		{Name: nodekind.SERVICE_HTTP_PROXY, Port: HTTP_PROXY_PORT},
+		{Name: nodekind.SERVICE_SOCKS_PROXY, Port: SOCKS_PROXY_PORT},
+		{Name: nodekind.SERVICE_SAM, Port: SAM_PORT},
+		{Name: nodekind.SERVICE_I2CP, Port: I2CP_PORT},
+	}
+}
+
+func (Kind) ContainerSpec(r nodekind.Router) nodekind.ContainerSpec {
+	return nodekind.ContainerSpec{
+		// The image's entrypoint publishes IP_ADDR; it would guess the address itself otherwise
+		Env:         []string{"IP_ADDR=" + r.Address()},
+		StopSignal:  STOP_SIGNAL,
+		StopTimeout: STOP_TIMEOUT,
+		// The config volume is written as root
+		User: "root",
+	}
+}
+
+// consoleURL returns the address of the router's console, which listens on the router's own address
+func consoleURL(r nodekind.Router) string {
+	return fmt.Sprintf("http://%s/", net.JoinHostPort(r.Address(), strconv.Itoa(CONSOLE_PORT)))
+}
+
+func (Kind) Probes() []nodekind.Probe {
+	return []nodekind.Probe{
+		{Name: nodekind.PROBE_ROUTER_INFO, Check: nodekind.FileProbe(CONFIG_DIR + "/router.info")},
+		{Name: nodekind.PROBE_CONSOLE, Check: nodekind.ConsoleProbe(consoleURL)},
+		{Name: nodekind.PROBE_TRANSPORTS, Check: nodekind.TransportsProbe(ROUTER_PORT)},
+		{Name: nodekind.PROBE_TUNNELS, Optional: true, Check: tunnelsProbe},
+	}
+}
+
+var tunnelCount = regexp.MustCompile(`(?s)Exploratory.*?(\d+)\s*</`)
+
+// tunnelsProbe checks on the console sidebar that the router has exploratory tunnels
+func tunnelsProbe(ctx context.Context, cli *client.Client, r nodekind.Router) (bool, string, error) {
+	url := consoleURL(r) + "xhr1.jsp"
+	page, ok, err := nodekind.FetchPage(ctx, cli, r, url)
+	if err != nil {
+		return false, "", err
+	}
+	if !ok {
+		return false, "console not answering on " + url, nil
+	}
+	match := tunnelCount.FindStringSubmatch(page)
+	if match == nil {
+		return false, "tunnel statistics not found on the console", nil
+	}
+	if count, _ := strconv.Atoi(match[1]); count == 0 {
+		return false, "no tunnel built yet", nil
+	}
+	return true, "", nil
+}
+
+// logLine matches the router's log format, e.g. "10/16 14:02:11.517 WARN  [NTCP Pumper ] ...NTCPTransport: ..."
+var logLine = regexp.MustCompile(`\b(DEBUG|INFO|WARN|ERROR|CRIT)\s+(\[.*)$`)
+
+func (Kind) ParseLogLine(line string) nodekind.LogEntry {
+	match := logLine.FindStringSubmatch(line)
+	if match == nil {
+		return nodekind.UnparsedLine(line)
+	}
+	return nodekind.LogEntry{Level: nodekind.NormalizeLevel(match[1]), Message: match[2], Line: line}
+}
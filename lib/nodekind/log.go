@@ -0,0 +1,55 @@
+package nodekind
+
+import "strings"
+
+// Log levels routers are normalised to
+const (
+	LEVEL_DEBUG = "debug"
+	LEVEL_INFO  = "info"
+	LEVEL_WARN  = "warn"
+	LEVEL_ERROR = "error"
+)
+
+var levelRanks = map[string]int{
+	LEVEL_DEBUG: 0,
+	LEVEL_INFO:  1,
+	LEVEL_WARN:  2,
+	LEVEL_ERROR: 3,
+}
+
+// LogEntry is a line a router logged. Level is empty if the line could not be parsed, e.g. a stack trace.
+type LogEntry struct {
+	Level   string `json:"level,omitempty"`
+	Message string `json:"message"`
+	Line    string `json:"line"`
+}
+
+// NormalizeLevel maps the level names routers use (e.g. "warning", "CRIT", "fatal") to one of the LEVEL_* values, or "" if unknown
+func NormalizeLevel(level string) string {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "trace", "debug":
+		return LEVEL_DEBUG
+	case "info", "notice":
+		return LEVEL_INFO
+	case "warn", "warning":
+		return LEVEL_WARN
+	case "error", "err", "crit", "critical", "fatal", "panic":
+		return LEVEL_ERROR
+	}
+	return ""
+}
+
+// AtLeast reports whether the entry's level is at least level. Unparsed lines only match the lowest level.
+func (e LogEntry) AtLeast(level string) bool {
+	min, ok := levelRanks[NormalizeLevel(level)]
+	if !ok || min == 0 {
+		return true
+	}
+	rank, ok := levelRanks[e.Level]
+	return ok && rank >= min
+}
+
+// UnparsedLine is the entry for a line a kind can't make sense of
+func UnparsedLine(line string) LogEntry {
+	return LogEntry{Message: line, Line: line}
+}
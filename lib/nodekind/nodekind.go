@@ -0,0 +1,242 @@
+package nodekind
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/utils/logger"
+	"strings"
+	"sync"
+)
+
+var log = logger.GetTestnetLogger()
+
+// NodeKind is a router implementation the testnet can run. Every kind registers itself with Register,
+// after which routers of that kind can be added, probed and synced like any other.
+type NodeKind interface {
+	// Name is the canonical kind name used in topology files, the state file and container labels
+	Name() string
+	// Aliases are other spellings accepted for the kind, e.g. "go-i2p"
+	Aliases() []string
+
+	// Image returns the image a router runs at a version, empty meaning latest. It needs /bin/sh and sleep, which
+	// hold the router's command back until the testnet has set up its network.
+	Image(version string) string
+	// BuildImage builds the image at a version unless it already exists
+	BuildImage(cli *client.Client, ctx context.Context, version string) error
+	// RemoveImage removes every local version of the image
+	RemoveImage(cli *client.Client, ctx context.Context) error
+
+	// DataDir is where the router keeps its configuration and data, the router's volume is mounted there
+	DataDir() string
+	// RouterInfoPath is the file the router writes its own RouterInfo to, empty if it doesn't write one
+	RouterInfoPath() string
+	// NetDbPath is the directory the router reads its netDb from, in the usual r<X>/routerInfo-<hash>.dat layout
+	NetDbPath() string
+
+	// Config returns the files written into the data dir before the router first starts
+	Config(r Router) ([]File, error)
+	// ContainerSpec describes how the router's container is run
+	ContainerSpec(r Router) ContainerSpec
+	// Probes are the readiness checks run once the container is up
+	Probes() []Probe
+	// ParseLogLine picks the level and message out of a line the router logged
+	ParseLogLine(line string) LogEntry
+}
+
+// SourceBuilder is implemented by kinds whose image can also be built from a local checkout
+type SourceBuilder interface {
+	// BuildImageFromSource builds the image from the checkout in srcDir and returns its tag
+	BuildImageFromSource(cli *client.Client, ctx context.Context, srcDir string) (string, error)
+}
+
+// ServicePublisher is implemented by kinds whose routers serve a console, proxies or client APIs that can be
+// published on host ports
+type ServicePublisher interface {
+	// Services lists the TCP ports a router serves on every interface when Router.ExposeServices is set
+	Services() []Service
+}
+
+// TransportSelector is implemented by kinds whose routers can run without some of their transports, or without
+// publishing them. Routers of other kinds always enable and publish every transport.
+type TransportSelector interface {
+	// Transports lists the transports, ntcp2 and ssu2, that Config enables and publishes as Router.Transports says
+	Transports() []string
+}
+
+// The names of the services a router can publish
+const (
+	SERVICE_CONSOLE     = "console"
+	SERVICE_HTTP_PROXY  = "http-proxy"
+	SERVICE_SOCKS_PROXY = "socks-proxy"
+	SERVICE_SAM         = "sam"
+	SERVICE_I2CP        = "i2cp"
+	SERVICE_I2PCONTROL  = "i2pcontrol"
+)
+
+// Service is a TCP port a router serves besides its transports
+type Service struct {
+	Name string
+	Port int
+}
+
+// Transport tells whether a router enables a transport and publishes its address in the router's RouterInfo
+type Transport struct {
+	Enabled   bool
+	Published bool
+}
+
+// Transports holds the settings of every transport of a router
+type Transports struct {
+	NTCP2 Transport
+	SSU2  Transport
+}
+
+// AllTransports enables and publishes every transport, as routers do unless told otherwise
+func AllTransports() Transports {
+	return Transports{NTCP2: Transport{Enabled: true, Published: true}, SSU2: Transport{Enabled: true, Published: true}}
+}
+
+// Router is what a kind gets to know about one of its routers
+type Router struct {
+	ID          int
+	Name        string
+	ContainerID string
+	IP          string
+	Floodfill   bool
+	Version     string
+	// IPv6 is the router's IPv6 address, empty on an IPv4-only testnet. An IPv6-only router has an IP as well,
+	// Docker needs one, but it is removed once the router runs.
+	IPv6 string
+	// IPv4Only and IPv6Only tell which address family the router is limited to, neither means both
+	IPv4Only bool
+	IPv6Only bool
+	// NAT is the kind of NAT the router is behind, full-cone or symmetric, empty if it isn't. IP is then its
+	// address on a private network and it has to find its public address itself.
+	NAT string
+	// ExposeServices binds the router's services to every interface instead of loopback, so they can be published
+	ExposeServices bool
+	// Transports tells which transports the router enables and publishes. Kinds that don't implement
+	// TransportSelector only ever get NTCP2 unpublished, for a router behind a symmetric NAT.
+	Transports Transports
+}
+
+// UsesIPv4 reports whether the router has an IPv4 address it may use
+func (r Router) UsesIPv4() bool {
+	return r.IP != "" && !r.IPv6Only
+}
+
+// UsesIPv6 reports whether the router has an IPv6 address it may use
+func (r Router) UsesIPv6() bool {
+	return r.IPv6 != "" && !r.IPv4Only
+}
+
+// Address returns the address the router can be reached on from inside its container: its IPv4 address,
+// or its IPv6 address if it only uses IPv6
+func (r Router) Address() string {
+	if r.UsesIPv4() {
+		return r.IP
+	}
+	return r.IPv6
+}
+
+// File is a file written into a router's data dir, Path is relative to it
+type File struct {
+	Path    string
+	Content string
+}
+
+// ContainerSpec holds the parts of a router container that differ between kinds.
+// The image, network, labels and volumes are set up by the testnet.
+type ContainerSpec struct {
+	// Cmd overrides the image's command if set. Either runs after the image's entrypoint, behind the testnet's gate.
+	Cmd []string
+	Env []string
+	// User overrides the image's user if set
+	User       string
+	StopSignal string
+	// StopTimeout is how many seconds a graceful shutdown may take before the router is killed
+	StopTimeout int
+}
+
+var (
+	registryMu sync.RWMutex
+	kinds      = map[string]NodeKind{}
+	aliases    = map[string]string{}
+	// order keeps kinds in registration order, so listings are stable
+	order []string
+)
+
+// Register makes a kind available to the testnet. It fails if the name or one of its aliases is taken.
+func Register(k NodeKind) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name := clean(k.Name())
+	if name == "" {
+		return fmt.Errorf("router kind has no name")
+	}
+	names := append([]string{name}, k.Aliases()...)
+	for _, n := range names {
+		if owner, ok := aliases[clean(n)]; ok {
+			return fmt.Errorf("router kind %q is already registered by %q", n, owner)
+		}
+	}
+	kinds[name] = k
+	for _, n := range names {
+		aliases[clean(n)] = name
+	}
+	order = append(order, name)
+	log.WithField("kind", name).Debug("Registered router kind")
+	return nil
+}
+
+// MustRegister registers a kind and panics if that fails, for kinds registered from init
+func MustRegister(k NodeKind) {
+	if err := Register(k); err != nil {
+		panic(err)
+	}
+}
+
+// clean lowercases a kind name and drops the "_router" suffix the CLI accepts
+func clean(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.TrimSuffix(name, "_router")
+}
+
+// Normalize maps any accepted spelling of a kind to its canonical name. Unknown names are returned cleaned up.
+func Normalize(name string) string {
+	name = clean(name)
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if canonical, ok := aliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// Lookup returns the kind with the given name or alias
+func Lookup(name string) (NodeKind, bool) {
+	name = Normalize(name)
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	k, ok := kinds[name]
+	return k, ok
+}
+
+// All returns every registered kind in registration order
+func All() []NodeKind {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	all := make([]NodeKind, 0, len(order))
+	for _, name := range order {
+		all = append(all, kinds[name])
+	}
+	return all
+}
+
+// Names returns the names of every registered kind in registration order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]string(nil), order...)
+}
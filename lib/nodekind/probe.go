@@ -0,0 +1,127 @@
+package nodekind
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"strings"
+)
+
+// Names of the readiness probes
+const (
+	PROBE_RUNNING     = "running"
+	PROBE_ROUTER_INFO = "router.info"
+	PROBE_CONSOLE     = "console"
+	PROBE_TRANSPORTS  = "transports"
+	PROBE_TUNNELS     = "tunnels"
+)
+
+// CheckFunc runs a probe against a router. A failing check returns false and a short description of what is missing.
+type CheckFunc func(ctx context.Context, cli *client.Client, r Router) (bool, string, error)
+
+// Probe checks one aspect of whether a router is up
+type Probe struct {
+	Name string
+	// Optional probes only count when tunnels are asked for, as building them takes much longer than starting up
+	Optional bool
+	Check    CheckFunc
+}
+
+// FileProbe checks that a file exists in the router container
+func FileProbe(path string) CheckFunc {
+	return func(ctx context.Context, cli *client.Client, r Router) (bool, string, error) {
+		exists, err := docker_control.ContainerFS(cli, r.ContainerID, "/").Exists(ctx, path)
+		if err != nil || !exists {
+			return false, path + " not written yet", err
+		}
+		return true, "", nil
+	}
+}
+
+// FetchPage fetches a page from inside the router container, so consoles bound to loopback can be reached.
+// ok is false if the page could not be fetched.
+func FetchPage(ctx context.Context, cli *client.Client, r Router, url string) (string, bool, error) {
+	code, out, err := docker_control.ExecInContainer(cli, ctx, r.ContainerID, []string{"wget", "-q", "-O", "-", url})
+	if err != nil {
+		return "", false, err
+	}
+	return out, code == 0, nil
+}
+
+// ConsoleProbe checks that the web console at the router's console address answers
+func ConsoleProbe(console func(r Router) string) CheckFunc {
+	return func(ctx context.Context, cli *client.Client, r Router) (bool, string, error) {
+		url := console(r)
+		code, _, err := docker_control.ExecInContainer(cli, ctx, r.ContainerID, []string{"wget", "-q", "-O", "/dev/null", url})
+		if err != nil {
+			return false, "", err
+		}
+		if code != 0 {
+			return false, "console not answering on " + url, nil
+		}
+		return true, "", nil
+	}
+}
+
+// TransportsProbe checks that NTCP2 listens on TCP and SSU2 on UDP, if the router publishes them. A router
+// doesn't necessarily accept connections on a transport it only uses to connect out, i2pd doesn't.
+// With port 0 any socket not bound to loopback counts, for routers that bind everything else there, except the
+// ports of the given services, which are bound to every interface when they are published.
+func TransportsProbe(port int, services ...Service) CheckFunc {
+	return func(ctx context.Context, cli *client.Client, r Router) (bool, string, error) {
+		code, out, err := docker_control.ExecInContainer(cli, ctx, r.ContainerID, []string{"netstat", "-ltun"})
+		if err != nil {
+			return false, "", err
+		}
+		if code != 0 {
+			return false, "cannot list sockets: " + strings.TrimSpace(out), nil
+		}
+		ok, missing := transportsListening(out, port, services, r.Transports)
+		return ok, missing, nil
+	}
+}
+
+// transportsListening checks the output of netstat -ltun for the listeners of the published transports, see
+// TransportsProbe. It returns false and what is missing if one isn't there.
+func transportsListening(netstat string, port int, services []Service, transports Transports) (bool, string) {
+	suffix := fmt.Sprintf(":%d", port)
+	isService := func(addr string) bool {
+		for _, service := range services {
+			if strings.HasSuffix(addr, fmt.Sprintf(":%d", service.Port)) {
+				return true
+			}
+		}
+		return false
+	}
+	tcp, udp := false, false
+	for _, line := range strings.Split(netstat, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || strings.HasPrefix(fields[3], "127.") || strings.HasPrefix(fields[3], "::1:") {
+			continue
+		}
+		if port != 0 && !strings.HasSuffix(fields[3], suffix) {
+			continue
+		}
+		if port == 0 && isService(fields[3]) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(fields[0], "tcp") && strings.Contains(line, "LISTEN"):
+			tcp = true
+		case strings.HasPrefix(fields[0], "udp"):
+			udp = true
+		}
+	}
+	tcp = tcp || !transports.NTCP2.Published
+	udp = udp || !transports.SSU2.Published
+	switch {
+	case !tcp && !udp:
+		return false, "no NTCP2 or SSU2 listener"
+	case !tcp:
+		return false, "no NTCP2 listener"
+	case !udp:
+		return false, "no SSU2 listener"
+	}
+	return true, ""
+}
@@ -0,0 +1,91 @@
+package nodekind
+
+import "testing"
+
+const netstatHeader = `Active Internet connections (only servers)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State
+tcp        0      0 127.0.0.1:7070          0.0.0.0:*               LISTEN
+`
+
+func TestTransportsListening(t *testing.T) {
+	unpublishedNTCP2 := AllTransports()
+	unpublishedNTCP2.NTCP2.Published = false
+	ssu2Only := Transports{SSU2: Transport{Enabled: true, Published: true}}
+	ntcp2Only := Transports{NTCP2: Transport{Enabled: true, Published: true}}
+	services := []Service{{Name: SERVICE_CONSOLE, Port: 7070}, {Name: SERVICE_SAM, Port: 7656}}
+
+	tests := []struct {
+		name       string
+		netstat    string
+		port       int
+		transports Transports
+		ok         bool
+		missing    string
+	}{
+		{
+			name:       "both listening",
+			netstat:    netstatHeader + "tcp 0 0 172.28.0.2:12345 0.0.0.0:* LISTEN\nudp 0 0 172.28.0.2:12345 0.0.0.0:*\n",
+			port:       12345,
+			transports: AllTransports(),
+			ok:         true,
+		},
+		{
+			name:       "nothing but loopback",
+			netstat:    netstatHeader,
+			transports: AllTransports(),
+			missing:    "no NTCP2 or SSU2 listener",
+		},
+		{
+			name:       "no udp",
+			netstat:    netstatHeader + "tcp 0 0 172.28.0.2:12345 0.0.0.0:* LISTEN\n",
+			transports: AllTransports(),
+			missing:    "no SSU2 listener",
+		},
+		{
+			name:       "other port",
+			netstat:    netstatHeader + "tcp 0 0 172.28.0.2:4444 0.0.0.0:* LISTEN\nudp 0 0 172.28.0.2:12345 0.0.0.0:*\n",
+			port:       12345,
+			transports: AllTransports(),
+			missing:    "no NTCP2 listener",
+		},
+		{
+			name:       "published services don't count",
+			netstat:    netstatHeader + "tcp 0 0 0.0.0.0:7656 0.0.0.0:* LISTEN\nudp 0 0 172.28.0.2:23456 0.0.0.0:*\n",
+			transports: AllTransports(),
+			missing:    "no NTCP2 listener",
+		},
+		{
+			// i2pd opens no NTCP2 acceptor when NTCP2 isn't published, which is always the case behind a symmetric NAT
+			name:       "i2pd behind a symmetric NAT",
+			netstat:    netstatHeader + "udp 0 0 10.100.0.3:23456 0.0.0.0:*\n",
+			transports: unpublishedNTCP2,
+			ok:         true,
+		},
+		{
+			name:       "ssu2 only",
+			netstat:    netstatHeader + "udp 0 0 172.28.0.2:23456 0.0.0.0:*\n",
+			transports: ssu2Only,
+			ok:         true,
+		},
+		{
+			name:       "ntcp2 only without listener",
+			netstat:    netstatHeader + "udp 0 0 172.28.0.2:23456 0.0.0.0:*\n",
+			transports: ntcp2Only,
+			missing:    "no NTCP2 listener",
+		},
+		{
+			name:       "nothing published",
+			netstat:    netstatHeader,
+			transports: Transports{NTCP2: Transport{Enabled: true}, SSU2: Transport{Enabled: true}},
+			ok:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, missing := transportsListening(tt.netstat, tt.port, services, tt.transports)
+			if ok != tt.ok || missing != tt.missing {
+				t.Errorf("transportsListening() = %v, %q, want %v, %q", ok, missing, tt.ok, tt.missing)
+			}
+		})
+	}
+}
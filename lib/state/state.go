@@ -0,0 +1,179 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-i2p-testnet/lib/topology"
+	"go-i2p-testnet/lib/utils/logger"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var log = logger.GetTestnetLogger()
+
+const (
+	// STATE_DIR_ENV overrides the directory the state files are kept in
+	STATE_DIR_ENV = "TESTNET_STATE_DIR"
+	stateFileExt  = ".json"
+)
+
+// ErrNoState is returned by Load when no testnet state has been saved
+var ErrNoState = errors.New("no testnet state found")
+
+// Router is the persisted record of a router container
+type Router struct {
+	ID          int                  `json:"id"`
+	Name        string               `json:"name"`
+	Kind        string               `json:"kind"`
+	ContainerID string               `json:"container_id"`
+	VolumeName  string               `json:"volume_name"`
+	IP          string               `json:"ip"`
+	Options     topology.NodeOptions `json:"options"`
+	// IPv6 is the router's address on a dual-stack testnet
+	IPv6 string `json:"ipv6,omitempty"`
+	// AddressFamily is the address family the router uses, with the default of its options resolved
+	AddressFamily string `json:"address_family,omitempty"`
+	// NAT is the gateway of a router behind a NAT, nil if the router is on the testnet network itself
+	NAT *NATGateway `json:"nat,omitempty"`
+}
+
+// NATGateway is the persisted record of the gateway container and private network of a router behind a NAT.
+// The router's IP is the gateway's address on the testnet network, the one its peers see.
+type NATGateway struct {
+	ContainerID string `json:"container_id"`
+	Name        string `json:"name"`
+	Network     string `json:"network"`
+	Subnet      string `json:"subnet"`
+	// GatewayIP and RouterIP are the addresses of the gateway and the router on the private network
+	GatewayIP string `json:"gateway_ip"`
+	RouterIP  string `json:"router_ip"`
+	// IPv6 is the gateway's address on a dual-stack testnet, the router itself only uses IPv4
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
+// State is everything needed to manage a running testnet from another process
+type State struct {
+	// ID is the testnet ID every Docker resource of the testnet is labelled with
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	NetworkName  string   `json:"network_name"`
+	Subnet       string   `json:"subnet"`
+	NetworkID    string   `json:"network_id"`
+	SharedVolume string   `json:"shared_volume"`
+	Routers      []Router `json:"routers"`
+	Containers   []string `json:"containers"`
+	Volumes      []string `json:"volumes"`
+	// NextRouterID is the ID the next router gets, IDs are never reused so names stay unique after removals
+	NextRouterID int `json:"next_router_id"`
+	// Subnet6 is the IPv6 subnet of a dual-stack testnet
+	Subnet6 string `json:"subnet6,omitempty"`
+	// Addresses maps every address handed out in the subnets to the container it belongs to
+	Addresses map[string]string `json:"addresses,omitempty"`
+	// LastAddress is the address handed out most recently, the next one is searched for after it
+	LastAddress string `json:"last_address,omitempty"`
+	// LastAddress6 is the IPv6 address handed out most recently
+	LastAddress6 string `json:"last_address6,omitempty"`
+	// Partition maps each group of a partitioned testnet to the names of its routers, it is empty when all routers reach each other
+	Partition map[string][]string `json:"partition,omitempty"`
+	// Networks are the private networks of routers behind a NAT and the publish network, removed on stop like Containers and Volumes
+	Networks []string `json:"networks,omitempty"`
+}
+
+// Dir returns the directory state files are kept in, honouring TESTNET_STATE_DIR
+func Dir() (string, error) {
+	dir := os.Getenv(STATE_DIR_ENV)
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error finding home directory: %v", err)
+		}
+		dir = filepath.Join(home, ".go-i2p-testnet")
+	}
+	return dir, nil
+}
+
+// PathFor returns the location of the state file of the named testnet
+func PathFor(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+stateFileExt), nil
+}
+
+// List returns the names of all testnets that have a state file
+func List() ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+stateFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("error listing state files: %v", err)
+	}
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(match), stateFileExt))
+	}
+	return names, nil
+}
+
+// Load reads the testnet state from path, returning ErrNoState if it does not exist
+func Load(path string) (*State, error) {
+	log.WithField("path", path).Debug("Loading testnet state")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+	s := &State{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("error parsing state file %s: %v", path, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"path":    path,
+		"routers": len(s.Routers),
+	}).Debug("Successfully loaded testnet state")
+	return s, nil
+}
+
+// Exists reports whether a state file is present at path
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Save atomically writes the testnet state to path
+func Save(path string, s *State) error {
+	log.WithField("path", path).Debug("Saving testnet state")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state: %v", err)
+	}
+	// Write to a temporary file first so a crash never leaves a truncated state file behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error replacing state file: %v", err)
+	}
+	return nil
+}
+
+// Remove deletes the state file, ignoring a missing file
+func Remove(path string) error {
+	log.WithField("path", path).Debug("Removing testnet state")
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing state file: %v", err)
+	}
+	return nil
+}
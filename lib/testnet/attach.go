@@ -0,0 +1,109 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/state"
+	"strings"
+)
+
+// Attach takes over the testnet recorded in s, e.g. after the process that started it crashed.
+// Every recorded resource is checked against Docker; routers whose containers are gone are dropped and returned.
+func Attach(cli *client.Client, ctx context.Context, s *state.State) (*Testnet, []state.Router, error) {
+	log.WithFields(map[string]interface{}{
+		"network": s.NetworkName,
+		"routers": len(s.Routers),
+	}).Debug("Attaching to testnet from saved state")
+
+	networkRef := s.NetworkID
+	if networkRef == "" {
+		networkRef = s.NetworkName
+	}
+	if _, err := cli.NetworkInspect(ctx, networkRef, network.InspectOptions{}); err != nil {
+		if !client.IsErrNotFound(err) {
+			return nil, nil, fmt.Errorf("error inspecting network %s: %v", s.NetworkName, err)
+		}
+		log.WithField("network", s.NetworkName).Warn("Recorded network no longer exists")
+	}
+
+	// Drop routers whose containers are gone and refresh the addresses of the rest
+	var dropped []state.Router
+	routers := s.Routers[:0]
+	for _, r := range s.Routers {
+		info, err := cli.ContainerInspect(ctx, r.ContainerID)
+		if client.IsErrNotFound(err) {
+			log.WithField("routerID", r.ID).Debug("Recorded router no longer exists")
+			dropped = append(dropped, r)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error inspecting container %s: %v", r.ContainerID, err)
+		}
+		if info.Name != "" {
+			r.Name = strings.TrimPrefix(info.Name, "/")
+		}
+		if info.NetworkSettings != nil {
+			if endpoint, ok := info.NetworkSettings.Networks[s.NetworkName]; ok && endpoint.IPAddress != "" {
+				r.IP = endpoint.IPAddress
+				if endpoint.GlobalIPv6Address != "" {
+					r.IPv6 = endpoint.GlobalIPv6Address
+				}
+			}
+		}
+		routers = append(routers, r)
+	}
+	s.Routers = routers
+
+	containers := s.Containers[:0]
+	for _, containerID := range s.Containers {
+		_, err := cli.ContainerInspect(ctx, containerID)
+		if client.IsErrNotFound(err) {
+			log.WithField("containerID", containerID).Debug("Recorded container no longer exists")
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error inspecting container %s: %v", containerID, err)
+		}
+		containers = append(containers, containerID)
+	}
+	s.Containers = containers
+
+	volumes := s.Volumes[:0]
+	for _, volumeName := range s.Volumes {
+		_, err := cli.VolumeInspect(ctx, volumeName)
+		if client.IsErrNotFound(err) {
+			log.WithField("volumeName", volumeName).Debug("Recorded volume no longer exists")
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error inspecting volume %s: %v", volumeName, err)
+		}
+		volumes = append(volumes, volumeName)
+	}
+	s.Volumes = volumes
+
+	networks := s.Networks[:0]
+	for _, name := range s.Networks {
+		_, err := cli.NetworkInspect(ctx, name, network.InspectOptions{})
+		if client.IsErrNotFound(err) {
+			log.WithField("networkName", name).Debug("Recorded network no longer exists")
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error inspecting network %s: %v", name, err)
+		}
+		networks = append(networks, name)
+	}
+	s.Networks = networks
+
+	t := FromState(cli, s)
+	t.mu.Lock()
+	for _, r := range dropped {
+		// Whatever is left of its volume and NAT gateway is still removed on stop
+		t.forgetRouter(r)
+	}
+	t.mu.Unlock()
+	return t, dropped, nil
+}
@@ -0,0 +1,34 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/topology"
+)
+
+// applyFamily removes the addresses of the family a router on a dual-stack testnet must not use.
+// Docker assigns them again whenever the container starts, so it runs after every start, before the router's process.
+func (t *Testnet) applyFamily(ctx context.Context, r state.Router) error {
+	if r.IPv6 == "" || (r.AddressFamily != topology.FAMILY_IPV4 && r.AddressFamily != topology.FAMILY_IPV6) {
+		return nil
+	}
+	if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+		return fmt.Errorf("error building the netem image: %v", err)
+	}
+	dropIPv6 := r.AddressFamily == topology.FAMILY_IPV4
+	if err := docker_control.DropAddressFamily(t.cli, ctx, t.Ref(), r.ContainerID, dropIPv6); err != nil {
+		return fmt.Errorf("error limiting router %s to %s: %v", r.Name, r.AddressFamily, err)
+	}
+	return nil
+}
+
+// routerAddresses returns the addresses a router has on the testnet network, its IPv6 address too on a dual-stack one
+func routerAddresses(r state.Router) []string {
+	addrs := []string{r.IP}
+	if r.IPv6 != "" {
+		addrs = append(addrs, r.IPv6)
+	}
+	return addrs
+}
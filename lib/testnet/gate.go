@@ -0,0 +1,38 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/state"
+)
+
+// applyNetwork sets up what a router's network namespace loses when its container stops: its isolation from the
+// publish network, the route to its NAT gateway, the address family it is limited to, its link conditions and the
+// routes of a partition. Then it lets the router's process start, which waits for it, see openGate.
+func (t *Testnet) applyNetwork(ctx context.Context, r state.Router) error {
+	if err := t.applyPublish(ctx, r); err != nil {
+		return err
+	}
+	if err := t.applyNAT(ctx, r); err != nil {
+		return err
+	}
+	if err := t.applyFamily(ctx, r); err != nil {
+		return err
+	}
+	if err := t.applyNetem(ctx, r); err != nil {
+		return err
+	}
+	if err := t.applyPartition(ctx, r); err != nil {
+		return err
+	}
+	return t.openGate(ctx, r)
+}
+
+// openGate lets a router's process start once the network of its container is set up
+func (t *Testnet) openGate(ctx context.Context, r state.Router) error {
+	if err := docker_control.OpenGate(t.cli, ctx, r.ContainerID); err != nil {
+		return fmt.Errorf("error starting router %s: %v", r.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package testnet
+
+// The built-in router kinds register themselves with nodekind when imported
+import (
+	_ "go-i2p-testnet/lib/go-i2p"
+	_ "go-i2p-testnet/lib/i2pd"
+	_ "go-i2p-testnet/lib/i2pjava"
+)
@@ -0,0 +1,53 @@
+package testnet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/state"
+	"strings"
+)
+
+// Logs returns the last tail lines a router wrote to stdout and stderr, or all of them if tail is "all"
+func (t *Testnet) Logs(ctx context.Context, r state.Router, tail string) (string, error) {
+	reader, err := t.cli.ContainerLogs(ctx, r.ContainerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       tail,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error reading logs of router %s: %v", r.Name, err)
+	}
+	defer reader.Close()
+
+	// Router containers run without a TTY, so stdout and stderr come multiplexed
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, reader); err != nil {
+		return "", fmt.Errorf("error reading logs of router %s: %v", r.Name, err)
+	}
+	return out.String(), nil
+}
+
+// LogEntries returns the last tail lines a router logged, parsed by its kind
+func (t *Testnet) LogEntries(ctx context.Context, r state.Router, tail string) ([]nodekind.LogEntry, error) {
+	logs, err := t.Logs(ctx, r, tail)
+	if err != nil {
+		return nil, err
+	}
+	k, known := nodekind.Lookup(r.Kind)
+	var entries []nodekind.LogEntry
+	for _, line := range strings.Split(strings.TrimRight(logs, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if !known {
+			entries = append(entries, nodekind.UnparsedLine(line))
+			continue
+		}
+		entries = append(entries, k.ParseLogLine(line))
+	}
+	return entries, nil
+}
@@ -0,0 +1,69 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/state"
+)
+
+// createNAT puts up the private network and the gateway of a router behind a NAT. The gateway takes the router's
+// addresses on the testnet network, which r.NAT must already hold the IPv6 one of. Nothing is left behind on failure.
+func (t *Testnet) createNAT(ctx context.Context, r *state.Router) error {
+	if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+		return fmt.Errorf("error building the netem image: %v", err)
+	}
+	ref := t.Ref()
+	t.natMu.Lock()
+	lan, err := docker_control.CreateNATNetwork(t.cli, ctx, ref, r.NAT.Network)
+	t.natMu.Unlock()
+	if err != nil {
+		return err
+	}
+	gatewayID, err := docker_control.CreateNATGateway(t.cli, ctx, ref, docker_control.NATGateway{
+		Name: r.NAT.Name,
+		Mode: r.Options.NAT,
+		IP:   r.IP,
+		IPv6: r.NAT.IPv6,
+	}, lan)
+	if err != nil {
+		if rerr := docker_control.RemoveNATGateway(t.cli, ctx, "", lan.Name); rerr != nil {
+			log.WithError(rerr).Error("Failed to remove NAT network after failed setup")
+		}
+		return err
+	}
+	r.NAT.ContainerID = gatewayID
+	r.NAT.Subnet = lan.Subnet
+	r.NAT.GatewayIP = lan.GatewayIP
+	r.NAT.RouterIP = lan.RouterIP
+	log.WithFields(map[string]interface{}{
+		"router":    r.Name,
+		"nat":       r.Options.NAT,
+		"publicIP":  r.IP,
+		"privateIP": lan.RouterIP,
+	}).Debug("Created NAT gateway")
+	return nil
+}
+
+// removeNAT removes the gateway and private network of a router behind a NAT, the router container has to be gone
+func (t *Testnet) removeNAT(ctx context.Context, r state.Router) error {
+	if r.NAT == nil || r.NAT.ContainerID == "" {
+		return nil
+	}
+	if err := docker_control.RemoveNATGateway(t.cli, ctx, r.NAT.ContainerID, r.NAT.Network); err != nil {
+		return fmt.Errorf("error removing the NAT gateway of router %s: %v", r.Name, err)
+	}
+	return nil
+}
+
+// applyNAT routes a running router behind a NAT through its gateway. The route is lost whenever the container
+// stops, so it runs after every start, before the router's process.
+func (t *Testnet) applyNAT(ctx context.Context, r state.Router) error {
+	if r.NAT == nil {
+		return nil
+	}
+	if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+		return fmt.Errorf("error building the netem image: %v", err)
+	}
+	return docker_control.RouteThroughGateway(t.cli, ctx, t.Ref(), r.ContainerID, r.NAT.GatewayIP)
+}
@@ -0,0 +1,73 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/topology"
+)
+
+// applyNetem installs the link conditions of a router's options in its network namespace, if it has any.
+// They are lost whenever the container stops, so they are applied again after every start.
+func (t *Testnet) applyNetem(ctx context.Context, r state.Router) error {
+	if r.Options.Netem.IsZero() {
+		return nil
+	}
+	args, err := r.Options.Netem.Args()
+	if err != nil {
+		return err
+	}
+	if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+		return fmt.Errorf("error building the netem image: %v", err)
+	}
+	if _, err := docker_control.SetNetem(t.cli, ctx, t.Ref(), r.ContainerID, netemAddresses(r), args); err != nil {
+		return fmt.Errorf("error emulating %s on router %s: %v", r.Options.Netem, r.Name, err)
+	}
+	log.WithFields(map[string]interface{}{
+		"router": r.Name,
+		"netem":  r.Options.Netem.String(),
+	}).Debug("Applied link conditions")
+	return nil
+}
+
+// netemAddresses returns the addresses of a router's link to the testnet, the only link netem applies to. A router
+// limited to IPv6 has only its IPv6 address left, a router behind a NAT reaches the testnet over its private network.
+func netemAddresses(r state.Router) []string {
+	if r.NAT != nil {
+		return []string{r.NAT.RouterIP}
+	}
+	return routerAddresses(r)
+}
+
+// SetNetem emulates link conditions on a running router, or clears them if n is zero, and records them in the
+// router's options so they survive restarts and end up in saved topologies. It returns the updated router.
+func (t *Testnet) SetNetem(ctx context.Context, r state.Router, n *topology.Netem) (state.Router, error) {
+	if err := n.Validate(); err != nil {
+		return r, err
+	}
+	if n.IsZero() {
+		if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+			return r, fmt.Errorf("error building the netem image: %v", err)
+		}
+		if _, err := docker_control.ClearNetem(t.cli, ctx, t.Ref(), r.ContainerID, netemAddresses(r)); err != nil {
+			return r, fmt.Errorf("error clearing link conditions of router %s: %v", r.Name, err)
+		}
+		r.Options.Netem = nil
+	} else {
+		r.Options.Netem = n
+		if err := t.applyNetem(ctx, r); err != nil {
+			return r, err
+		}
+	}
+	t.update(r)
+	return r, nil
+}
+
+// NetemStatus returns the queueing discipline of a running router's link to the testnet, as tc shows it
+func (t *Testnet) NetemStatus(ctx context.Context, r state.Router) (string, error) {
+	if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+		return "", fmt.Errorf("error building the netem image: %v", err)
+	}
+	return docker_control.ShowNetem(t.cli, ctx, t.Ref(), r.ContainerID, netemAddresses(r))
+}
@@ -0,0 +1,220 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/state"
+	"sort"
+	"strings"
+)
+
+// REST_GROUP is the partition group of the routers that were not put in a group, including routers added later
+const REST_GROUP = "rest"
+
+// copyPartition returns a deep copy of a partition, nil if there is none
+func copyPartition(partition map[string][]string) map[string][]string {
+	if len(partition) == 0 {
+		return nil
+	}
+	copied := make(map[string][]string, len(partition))
+	for group, names := range partition {
+		copied[group] = append([]string(nil), names...)
+	}
+	return copied
+}
+
+// Partition returns the groups of a partitioned testnet with the names of their routers, nil if it isn't partitioned
+func (t *Testnet) Partition() map[string][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return copyPartition(t.partition)
+}
+
+// Partitioned reports whether routers in different groups are cut off from each other
+func (t *Testnet) Partitioned() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.partition) > 0
+}
+
+// blockedRouters returns the routers outside r's partition group, r is in REST_GROUP if it has no group
+func (t *Testnet) blockedRouters(r state.Router) []state.Router {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.partition) == 0 {
+		return nil
+	}
+	groupOf := map[string]string{}
+	for group, names := range t.partition {
+		for _, name := range names {
+			groupOf[name] = group
+		}
+	}
+	group := func(name string) string {
+		if g, ok := groupOf[name]; ok {
+			return g
+		}
+		return REST_GROUP
+	}
+	var blocked []state.Router
+	for _, peer := range t.routers {
+		if peer.ID != r.ID && group(peer.Name) != group(r.Name) {
+			blocked = append(blocked, peer)
+		}
+	}
+	return blocked
+}
+
+// blockedPeers returns the addresses of the routers outside r's partition group
+func (t *Testnet) blockedPeers(r state.Router) []string {
+	var addrs []string
+	for _, peer := range t.blockedRouters(r) {
+		addrs = append(addrs, routerAddresses(peer)...)
+	}
+	return addrs
+}
+
+// applyPartition cuts a running router off from the routers outside its partition group, or lets it reach every
+// router again if the testnet isn't partitioned. Routes are lost whenever the container stops, so it runs after every
+// start, before the router's process.
+func (t *Testnet) applyPartition(ctx context.Context, r state.Router) error {
+	if !t.Partitioned() {
+		return nil
+	}
+	return t.routePeers(ctx, r)
+}
+
+// routePeers replaces the blocked peers of a running router with the ones of the current partition
+func (t *Testnet) routePeers(ctx context.Context, r state.Router) error {
+	if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+		return fmt.Errorf("error building the netem image: %v", err)
+	}
+	t.partitionMu.Lock()
+	defer t.partitionMu.Unlock()
+	if err := docker_control.BlockPeers(t.cli, ctx, t.Ref(), r.ContainerID, t.blockedPeers(r)); err != nil {
+		return fmt.Errorf("error partitioning router %s: %v", r.Name, err)
+	}
+	return nil
+}
+
+// joinPartition cuts a router just added to a partitioned testnet off from the routers outside its group, and them off
+// from it. Only the routes to and from the new router change, so adding a router costs one sidecar per router in the
+// other groups instead of rebuilding the routes of every router.
+func (t *Testnet) joinPartition(ctx context.Context, r state.Router) error {
+	if !t.Partitioned() {
+		return nil
+	}
+	if err := t.routePeers(ctx, r); err != nil {
+		return err
+	}
+	peers := t.blockedRouters(r)
+	var failures []string
+	for _, peer := range peers {
+		if !t.routerRunning(ctx, peer) {
+			continue
+		}
+		t.partitionMu.Lock()
+		err := docker_control.BlockPeer(t.cli, ctx, t.Ref(), peer.ContainerID, routerAddresses(r))
+		t.partitionMu.Unlock()
+		if err != nil {
+			log.WithFields(map[string]interface{}{
+				"router": peer.Name,
+				"error":  err,
+			}).Error("Failed to block new router")
+			failures = append(failures, fmt.Sprintf("error cutting router %s off from %s: %v", peer.Name, r.Name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to partition %d of %d routers from %s: %s", len(failures), len(peers), r.Name, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// routerRunning reports whether a router's container runs, or may run if it can't be inspected, so its routes can
+// be changed. Stopped routers get theirs when they are started again.
+func (t *Testnet) routerRunning(ctx context.Context, r state.Router) bool {
+	inspect, err := t.cli.ContainerInspect(ctx, r.ContainerID)
+	if err == nil && (inspect.State == nil || !inspect.State.Running) {
+		log.WithField("router", r.Name).Debug("Router isn't running, its routes are set when it starts")
+		return false
+	}
+	return true
+}
+
+// routeAll updates the blocked peers of every running router and returns an error summarising the routers that failed.
+// Stopped routers get theirs when they are started again.
+func (t *Testnet) routeAll(ctx context.Context, action string) error {
+	routers := t.Routers()
+	var failures []string
+	for _, r := range routers {
+		if !t.routerRunning(ctx, r) {
+			continue
+		}
+		if err := t.routePeers(ctx, r); err != nil {
+			log.WithFields(map[string]interface{}{
+				"router": r.Name,
+				"error":  err,
+			}).Error("Failed to update blocked peers")
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to %s %d of %d routers: %s", action, len(failures), len(routers), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// PartitionRouters splits the testnet into groups of routers that can reach each other but no router of another
+// group. Routers that are in no group form REST_GROUP, and so do routers added while the testnet is partitioned.
+// Routers keep their addresses and identities, Heal joins the groups again.
+func (t *Testnet) PartitionRouters(ctx context.Context, groups map[string][]state.Router) error {
+	if !t.Running() {
+		return fmt.Errorf("testnet %s isn't running", t.Name())
+	}
+	partition := map[string][]string{}
+	seen := map[int]string{}
+	for group, routers := range groups {
+		if group == "" {
+			return fmt.Errorf("partition groups need a name")
+		}
+		for _, r := range routers {
+			if other, ok := seen[r.ID]; ok && other != group {
+				return fmt.Errorf("router %s is in both group %s and group %s", r.Name, other, group)
+			}
+			if _, ok := seen[r.ID]; !ok {
+				partition[group] = append(partition[group], r.Name)
+			}
+			seen[r.ID] = group
+		}
+	}
+	for _, r := range t.Routers() {
+		if _, ok := seen[r.ID]; !ok {
+			partition[REST_GROUP] = append(partition[REST_GROUP], r.Name)
+		}
+	}
+	if len(partition) < 2 {
+		return fmt.Errorf("a partition needs at least two groups of routers")
+	}
+	for _, names := range partition {
+		sort.Strings(names)
+	}
+
+	t.mu.Lock()
+	t.partition = partition
+	t.mu.Unlock()
+	log.WithField("groups", partition).Debug("Partitioning testnet")
+	return t.routeAll(ctx, "partition")
+}
+
+// Heal lets every router reach every other router again after PartitionRouters
+func (t *Testnet) Heal(ctx context.Context) error {
+	if !t.Running() {
+		return fmt.Errorf("testnet %s isn't running", t.Name())
+	}
+	t.mu.Lock()
+	t.partition = nil
+	t.mu.Unlock()
+	log.Debug("Healing testnet partition")
+	return t.routeAll(ctx, "heal")
+}
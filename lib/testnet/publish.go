@@ -0,0 +1,90 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/state"
+)
+
+// PublishedPort is a service of a router and the host address it is published on
+type PublishedPort struct {
+	Service string `json:"service"`
+	Port    int    `json:"port"`
+	// Host is the address on the host, empty while the router isn't running
+	Host string `json:"host"`
+}
+
+// services returns the services a router of the kind publishes, or an error if it has none
+func services(k nodekind.NodeKind) ([]nodekind.Service, error) {
+	if publisher, ok := k.(nodekind.ServicePublisher); ok {
+		if services := publisher.Services(); len(services) > 0 {
+			return services, nil
+		}
+	}
+	return nil, fmt.Errorf("router kind %s has no services to publish", k.Name())
+}
+
+// ensurePublishNetwork creates the publish network the first time a router publishes its services
+func (t *Testnet) ensurePublishNetwork(ctx context.Context) error {
+	t.publishMu.Lock()
+	defer t.publishMu.Unlock()
+	ref := t.Ref()
+	name := ref.PublishNetwork()
+	t.mu.Lock()
+	for _, network := range t.networks {
+		if network == name {
+			t.mu.Unlock()
+			return nil
+		}
+	}
+	t.mu.Unlock()
+	if _, err := docker_control.CreatePublishNetwork(t.cli, ctx, ref); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.networks = append(t.networks, name)
+	t.mu.Unlock()
+	return nil
+}
+
+// applyPublish cuts a running router that publishes its services off from the internet and from the other routers
+// on the publish network again, which it gets routes to on every start. A router behind a NAT is then routed
+// through its gateway.
+func (t *Testnet) applyPublish(ctx context.Context, r state.Router) error {
+	if !r.Options.IsPublished() {
+		return nil
+	}
+	if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+		return fmt.Errorf("error building the netem image: %v", err)
+	}
+	if err := docker_control.IsolateContainer(t.cli, ctx, t.Ref(), r.ContainerID); err != nil {
+		return fmt.Errorf("error isolating router %s: %v", r.Name, err)
+	}
+	return nil
+}
+
+// Ports lists the services a router publishes with their host addresses, nil if it doesn't publish any
+func (t *Testnet) Ports(ctx context.Context, r state.Router) ([]PublishedPort, error) {
+	if !r.Options.IsPublished() {
+		return nil, nil
+	}
+	k, ok := nodekind.Lookup(r.Kind)
+	if !ok {
+		return nil, fmt.Errorf("unknown router kind %q", r.Kind)
+	}
+	services, err := services(k)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := docker_control.PublishedPorts(t.cli, ctx, r.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]PublishedPort, 0, len(services))
+	for _, service := range services {
+		ports = append(ports, PublishedPort{Service: service.Name, Port: service.Port, Host: hosts[service.Port]})
+	}
+	return ports, nil
+}
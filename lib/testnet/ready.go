@@ -0,0 +1,125 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/state"
+	"strings"
+	"time"
+)
+
+// READY_POLL_INTERVAL is how often WaitReady checks routers that are not ready yet
+const READY_POLL_INTERVAL = time.Second
+
+// ProbeResult is the outcome of a single readiness probe
+type ProbeResult struct {
+	Probe  string `json:"probe"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Readiness is how far a router has come up
+type Readiness struct {
+	Ready  bool          `json:"ready"`
+	Probes []ProbeResult `json:"probes"`
+}
+
+// Reason describes the first probe that failed, or is empty when the router is ready
+func (r Readiness) Reason() string {
+	if r.Ready {
+		return ""
+	}
+	for _, p := range r.Probes {
+		if !p.OK {
+			if p.Detail == "" {
+				return p.Probe
+			}
+			return p.Probe + ": " + p.Detail
+		}
+	}
+	return ""
+}
+
+// RouterReady runs the readiness probes of the router's kind once its container is running. Unless tunnels is set, optional probes are run but do not count.
+func (t *Testnet) RouterReady(ctx context.Context, r state.Router, tunnels bool) (Readiness, error) {
+	readiness := Readiness{Ready: true}
+	info, err := t.cli.ContainerInspect(ctx, r.ContainerID)
+	if err != nil {
+		return readiness, fmt.Errorf("error inspecting router %s: %v", r.Name, err)
+	}
+	switch {
+	case info.State == nil || !info.State.Running:
+		readiness.Ready = false
+		readiness.Probes = append(readiness.Probes, ProbeResult{Probe: nodekind.PROBE_RUNNING, Detail: "container is not running"})
+		return readiness, nil
+	case info.State.Paused:
+		readiness.Ready = false
+		readiness.Probes = append(readiness.Probes, ProbeResult{Probe: nodekind.PROBE_RUNNING, Detail: "container is paused"})
+		return readiness, nil
+	}
+	readiness.Probes = append(readiness.Probes, ProbeResult{Probe: nodekind.PROBE_RUNNING, OK: true})
+
+	k, ok := nodekind.Lookup(r.Kind)
+	if !ok {
+		readiness.Ready = false
+		readiness.Probes = append(readiness.Probes, ProbeResult{Probe: "kind", Detail: fmt.Sprintf("unknown router kind %q", r.Kind)})
+		return readiness, nil
+	}
+	for _, probe := range k.Probes() {
+		ok, detail, err := probe.Check(ctx, t.cli, kindRouter(r))
+		if err != nil {
+			return readiness, fmt.Errorf("error running %s probe on router %s: %v", probe.Name, r.Name, err)
+		}
+		readiness.Probes = append(readiness.Probes, ProbeResult{Probe: probe.Name, OK: ok, Detail: detail})
+		if !ok && (!probe.Optional || tunnels) {
+			readiness.Ready = false
+		}
+	}
+	return readiness, nil
+}
+
+// WaitReady blocks until every given router is ready, or every router of the testnet if none are given.
+// With tunnels set, routers must also have built a tunnel. It gives up when ctx is done, naming the routers that are still not ready.
+func (t *Testnet) WaitReady(ctx context.Context, tunnels bool, routers ...state.Router) error {
+	if len(routers) == 0 {
+		routers = t.Routers()
+	}
+	log.WithFields(map[string]interface{}{
+		"routers": len(routers),
+		"tunnels": tunnels,
+	}).Debug("Waiting for routers to become ready")
+
+	pending := routers
+	reasons := map[int]string{}
+	for {
+		waiting := pending[:0]
+		for _, r := range pending {
+			readiness, err := t.RouterReady(ctx, r, tunnels)
+			if err != nil && ctx.Err() == nil {
+				return err
+			}
+			if err != nil || !readiness.Ready {
+				reasons[r.ID] = readiness.Reason()
+				waiting = append(waiting, r)
+				continue
+			}
+			log.WithField("router", r.Name).Debug("Router is ready")
+		}
+		pending = waiting
+		if len(pending) == 0 {
+			log.Debug("All routers are ready")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			var names []string
+			for _, r := range pending {
+				names = append(names, fmt.Sprintf("%s (%s)", r.Name, reasons[r.ID]))
+			}
+			return fmt.Errorf("%d routers not ready: %s: %v", len(pending), strings.Join(names, ", "), ctx.Err())
+		case <-time.After(READY_POLL_INTERVAL):
+		}
+	}
+}
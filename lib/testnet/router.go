@@ -0,0 +1,531 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/topology"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_PARALLEL is how many routers AddRouters creates at the same time when not told otherwise
+const DEFAULT_PARALLEL = 4
+
+// RouterSpec describes a router to add
+type RouterSpec struct {
+	Kind    string
+	Options topology.NodeOptions
+}
+
+// Progress is called by AddRouters once for every router, in the caller's goroutine, as soon as it is up or has failed
+type Progress func(done int, total int, spec RouterSpec, r state.Router, err error)
+
+// EnsureImage builds the image of a router kind at a version, unless it already exists
+func (t *Testnet) EnsureImage(ctx context.Context, kind string, version string) error {
+	k, ok := nodekind.Lookup(kind)
+	if !ok {
+		return fmt.Errorf("unknown router kind %q, available kinds: %s", kind, strings.Join(nodekind.Names(), ", "))
+	}
+	if err := k.BuildImage(t.cli, ctx, version); err != nil {
+		return fmt.Errorf("error building image %s: %v", k.Image(version), err)
+	}
+	return nil
+}
+
+// AddRouter creates and starts a router of the given kind, building its image at the version in opts first if needed
+func (t *Testnet) AddRouter(ctx context.Context, kind string, opts topology.NodeOptions) (state.Router, error) {
+	if err := t.EnsureImage(ctx, kind, opts.Version); err != nil {
+		return state.Router{}, err
+	}
+	if t.needsSidecar(opts) {
+		if err := docker_control.BuildNetemImage(t.cli, ctx); err != nil {
+			return state.Router{}, fmt.Errorf("error building the netem image: %v", err)
+		}
+	}
+	return t.addRouter(ctx, kind, opts)
+}
+
+// AddRouters creates the routers described by specs using at most parallel workers.
+// A router that fails does not stop the others; the routers that came up are returned together with an error summarising the failures.
+func (t *Testnet) AddRouters(ctx context.Context, specs []RouterSpec, parallel int, progress Progress) ([]state.Router, error) {
+	if parallel < 1 {
+		parallel = DEFAULT_PARALLEL
+	}
+	if parallel > len(specs) {
+		parallel = len(specs)
+	}
+	log.WithFields(map[string]interface{}{
+		"routers":  len(specs),
+		"parallel": parallel,
+	}).Debug("Creating routers")
+
+	// Build each image once up front rather than in every worker
+	imageErrs := map[string]error{}
+	var netemErr error
+	netemBuilt := false
+	for _, spec := range specs {
+		key := imageKey(spec)
+		if _, done := imageErrs[key]; !done {
+			imageErrs[key] = t.EnsureImage(ctx, spec.Kind, spec.Options.Version)
+		}
+		if t.needsSidecar(spec.Options) && !netemBuilt {
+			if netemErr = docker_control.BuildNetemImage(t.cli, ctx); netemErr != nil {
+				netemErr = fmt.Errorf("error building the netem image: %v", netemErr)
+			}
+			netemBuilt = true
+		}
+	}
+
+	type result struct {
+		spec   RouterSpec
+		router state.Router
+		err    error
+	}
+	queue := make(chan RouterSpec)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for spec := range queue {
+				if err := imageErrs[imageKey(spec)]; err != nil {
+					results <- result{spec: spec, err: err}
+					continue
+				}
+				if netemErr != nil && t.needsSidecar(spec.Options) {
+					results <- result{spec: spec, err: netemErr}
+					continue
+				}
+				r, err := t.addRouter(ctx, spec.Kind, spec.Options)
+				results <- result{spec: spec, router: r, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for _, spec := range specs {
+			select {
+			case queue <- spec:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	done := 0
+	var created []state.Router
+	var failures []string
+	for res := range results {
+		done++
+		if res.err != nil {
+			log.WithFields(map[string]interface{}{
+				"kind":  res.spec.Kind,
+				"error": res.err,
+			}).Error("Failed to create router")
+			failures = append(failures, res.err.Error())
+		} else {
+			created = append(created, res.router)
+		}
+		if progress != nil {
+			progress(done, len(specs), res.spec, res.router, res.err)
+		}
+	}
+
+	if done < len(specs) {
+		failures = append(failures, fmt.Sprintf("%d routers were not attempted: %v", len(specs)-done, ctx.Err()))
+	}
+	if len(failures) > 0 {
+		return created, fmt.Errorf("%d of %d routers failed: %s", len(specs)-len(created), len(specs), strings.Join(failures, "; "))
+	}
+	return created, nil
+}
+
+// imageKey identifies the image a router spec runs
+func imageKey(spec RouterSpec) string {
+	return topology.NormalizeKind(spec.Kind) + ":" + docker_control.VersionTag(spec.Options.Version)
+}
+
+// allocateRouter hands out the next router ID, the router's name and its addresses.
+// IDs are never reused, so names stay unique after removals; addresses of removed routers are.
+func (t *Testnet) allocateRouter(kind string) (state.Router, error) {
+	// Only the allocation needs the lock, so several routers can be created at once
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.running {
+		return state.Router{}, fmt.Errorf("testnet %s isn't running", t.ref.Name)
+	}
+	if t.ipam == nil || (t.dualStack && t.ipam6 == nil) {
+		return state.Router{}, fmt.Errorf("testnet %s has no address allocations, attach to it again", t.ref.Name)
+	}
+	r := state.Router{ID: t.nextRouterID, Kind: kind}
+	r.Name = RouterName(t.ref, kind, r.ID)
+	var err error
+	if r.IP, err = t.ipam.Allocate(r.Name); err != nil {
+		log.WithError(err).Error("Failed to allocate router IP")
+		return state.Router{}, err
+	}
+	// Docker gives every container of a dual-stack network both addresses, even if the router uses only one family
+	if t.ipam6 != nil {
+		if r.IPv6, err = t.ipam6.Allocate(r.Name); err != nil {
+			log.WithError(err).Error("Failed to allocate router IPv6 address")
+			t.ipam.Release(r.IP)
+			return state.Router{}, err
+		}
+	}
+	t.nextRouterID++
+	return r, nil
+}
+
+// releaseRouter returns the addresses of a router that was allocated but never tracked
+func (t *Testnet) releaseRouter(r state.Router) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.releaseAddress(r.IP)
+	t.releaseAddress(r.IPv6)
+	if r.NAT != nil {
+		t.releaseAddress(r.NAT.IPv6)
+	}
+}
+
+// addressFamily resolves the address family of a router's options: dual on a dual-stack testnet, ipv4 otherwise.
+// Routers behind a NAT always use ipv4.
+func (t *Testnet) addressFamily(opts topology.NodeOptions) (string, error) {
+	if err := topology.ValidateAddressFamily(opts.AddressFamily); err != nil {
+		return "", err
+	}
+	if err := topology.ValidateNAT(opts.NAT); err != nil {
+		return "", err
+	}
+	if opts.NAT != "" {
+		if opts.AddressFamily != "" && opts.AddressFamily != topology.FAMILY_IPV4 {
+			return "", fmt.Errorf("routers behind a NAT only use IPv4, not address family %s", opts.AddressFamily)
+		}
+		return topology.FAMILY_IPV4, nil
+	}
+	dualStack := t.DualStack()
+	switch {
+	case opts.AddressFamily == "" && dualStack:
+		return topology.FAMILY_DUAL, nil
+	case opts.AddressFamily == "":
+		return topology.FAMILY_IPV4, nil
+	case opts.AddressFamily != topology.FAMILY_IPV4 && !dualStack:
+		return "", fmt.Errorf("address family %s needs a dual-stack testnet, start it with --ipv6", opts.AddressFamily)
+	}
+	return opts.AddressFamily, nil
+}
+
+// needsSidecar reports whether a router with the given options needs the netem image to set up its network or NAT gateway
+func (t *Testnet) needsSidecar(opts topology.NodeOptions) bool {
+	family, err := t.addressFamily(opts)
+	return !opts.Netem.IsZero() || opts.NAT != "" || opts.IsPublished() || t.Partitioned() || (err == nil && family != topology.FAMILY_DUAL && t.DualStack())
+}
+
+// RouterName returns the container name of the router of a kind with the given ID
+func RouterName(ref docker_control.TestnetRef, kind string, routerID int) string {
+	return ref.ResourceName(fmt.Sprintf("router-%s-%d", kind, routerID))
+}
+
+// kindRouter describes a router to its kind, a router behind a NAT by its address on the private network
+func kindRouter(r state.Router) nodekind.Router {
+	kr := nodekind.Router{
+		ID:          r.ID,
+		Name:        r.Name,
+		ContainerID: r.ContainerID,
+		IP:          r.IP,
+		IPv6:        r.IPv6,
+		Floodfill:   r.Options.IsFloodfill(),
+		Version:     r.Options.Version,
+		IPv4Only:    r.AddressFamily == topology.FAMILY_IPV4,
+		IPv6Only:    r.AddressFamily == topology.FAMILY_IPV6,
+		// Published services have to listen on the publish network
+		ExposeServices: r.Options.IsPublished(),
+		Transports:     routerTransports(r.Options),
+	}
+	if r.NAT != nil {
+		kr.IP = r.NAT.RouterIP
+		kr.NAT = r.Options.NAT
+	}
+	return kr
+}
+
+// addRouter creates and starts a router of the given kind, its image must exist
+func (t *Testnet) addRouter(ctx context.Context, kind string, opts topology.NodeOptions) (state.Router, error) {
+	k, ok := nodekind.Lookup(kind)
+	if !ok {
+		return state.Router{}, fmt.Errorf("unknown router kind %q, available kinds: %s", kind, strings.Join(nodekind.Names(), ", "))
+	}
+	family, err := t.addressFamily(opts)
+	if err != nil {
+		return state.Router{}, err
+	}
+	if err := opts.CheckTransports(k); err != nil {
+		return state.Router{}, err
+	}
+	var ports []int
+	if opts.IsPublished() {
+		// The host reaches published ports over IPv4
+		if family == topology.FAMILY_IPV6 {
+			return state.Router{}, fmt.Errorf("routers publishing their services need IPv4, not address family %s", family)
+		}
+		services, err := services(k)
+		if err != nil {
+			return state.Router{}, err
+		}
+		for _, service := range services {
+			ports = append(ports, service.Port)
+		}
+		if err := t.ensurePublishNetwork(ctx); err != nil {
+			return state.Router{}, err
+		}
+	}
+	r, err := t.allocateRouter(k.Name())
+	if err != nil {
+		return state.Router{}, err
+	}
+	// Until the router is tracked, whatever of it was created is removed again if it can't be set up
+	tracked := false
+	defer func() {
+		if !tracked {
+			t.discardRouter(ctx, r)
+			t.releaseRouter(r)
+		}
+	}()
+	ref := t.Ref()
+	routerID, nextIP := r.ID, r.IP
+	r.VolumeName = ref.ResourceName(fmt.Sprintf("%s_router%d_config", k.Name(), routerID))
+	r.AddressFamily = family
+	r.Options = opts
+
+	// A router behind a NAT is on a private network, its gateway takes the addresses it got on the testnet network
+	var network string
+	if opts.NAT != "" {
+		r.NAT = &state.NATGateway{
+			Name:    r.Name + "-nat",
+			Network: r.Name + "-lan",
+			IPv6:    r.IPv6,
+		}
+		r.IPv6 = ""
+		if err := t.createNAT(ctx, &r); err != nil {
+			log.WithError(err).Error("Failed to create NAT gateway")
+			return state.Router{}, err
+		}
+		network, nextIP = r.NAT.Network, r.NAT.RouterIP
+	}
+
+	log.WithFields(map[string]interface{}{
+		"routerID": routerID,
+		"kind":     r.Kind,
+		"ip":       nextIP,
+		"ipv6":     r.IPv6,
+		"family":   family,
+	}).Debug("Generating router configuration")
+	configFiles, err := k.Config(kindRouter(r))
+	if err != nil {
+		log.WithError(err).Error("Failed to generate router config")
+		return state.Router{}, fmt.Errorf("error generating config of %s: %v", r.Name, err)
+	}
+
+	// Create configuration volume
+	createOptions := volume.CreateOptions{
+		Name:   r.VolumeName,
+		Labels: ref.RouterLabels(docker_control.ROLE_CONFIG, r.Kind),
+	}
+	if _, err := t.cli.VolumeCreate(ctx, createOptions); err != nil {
+		log.WithFields(map[string]interface{}{
+			"volumeName": r.VolumeName,
+			"error":      err,
+		}).Error("Failed to create volume")
+		return state.Router{}, fmt.Errorf("error creating volume: %v", err)
+	}
+
+	files := make(map[string][]byte, len(configFiles))
+	for _, f := range configFiles {
+		files[f.Path] = []byte(f.Content)
+	}
+
+	// Create and start router container
+	spec := k.ContainerSpec(kindRouter(r))
+	r.ContainerID, err = docker_control.CreateRouterContainer(t.cli, ctx, ref, docker_control.RouterContainer{
+		Name:        r.Name,
+		Kind:        r.Kind,
+		Image:       k.Image(opts.Version),
+		IP:          nextIP,
+		IPv6:        r.IPv6,
+		VolumeName:  r.VolumeName,
+		DataDir:     k.DataDir(),
+		Files:       files,
+		Cmd:         spec.Cmd,
+		Env:         spec.Env,
+		User:        spec.User,
+		StopSignal:  spec.StopSignal,
+		StopTimeout: spec.StopTimeout,
+		Network:     network,
+		Ports:       ports,
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to create router container")
+		return state.Router{}, err
+	}
+	if err := t.applyPublish(ctx, r); err != nil {
+		log.WithError(err).Error("Failed to isolate the router from the publish network")
+		return state.Router{}, err
+	}
+	if err := t.applyNAT(ctx, r); err != nil {
+		log.WithError(err).Error("Failed to route the router through its NAT gateway")
+		return state.Router{}, err
+	}
+	if err := t.applyFamily(ctx, r); err != nil {
+		log.WithError(err).Error("Failed to limit the router's address family")
+		return state.Router{}, err
+	}
+	if err := t.applyNetem(ctx, r); err != nil {
+		log.WithError(err).Error("Failed to apply link conditions")
+		return state.Router{}, err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"routerID":    routerID,
+		"containerID": r.ContainerID,
+		"volumeID":    r.VolumeName,
+		"ip":          nextIP,
+	}).Debug("Adding router to tracking lists")
+	t.track(r)
+	tracked = true
+
+	// A router added to a partitioned testnet joins the rest group, the other groups have to block it too
+	if err := t.joinPartition(ctx, r); err != nil {
+		log.WithError(err).Error("Failed to add router to the partition")
+		t.untrack(r)
+		t.discardRouter(ctx, r)
+		return state.Router{}, err
+	}
+	// Only now that its network is set up does the router send its first packet
+	if err := t.openGate(ctx, r); err != nil {
+		log.WithError(err).Error("Failed to start the router's process")
+		t.untrack(r)
+		t.discardRouter(ctx, r)
+		return state.Router{}, err
+	}
+	return r, nil
+}
+
+// discardRouter removes the container, volume and NAT gateway of a router that failed to come up, as far as they were
+// created. The container is looked up by name, as it may exist without its ID being known.
+func (t *Testnet) discardRouter(ctx context.Context, r state.Router) {
+	if err := t.cli.ContainerRemove(ctx, r.Name, container.RemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+		log.WithError(err).Error("Failed to remove router container")
+	}
+	if err := t.cli.VolumeRemove(ctx, r.VolumeName, true); err != nil && !client.IsErrNotFound(err) {
+		log.WithError(err).Error("Failed to remove router volume")
+	}
+	if err := t.removeNAT(ctx, r); err != nil {
+		log.WithError(err).Error("Failed to remove NAT gateway")
+	}
+}
+
+// stopOptions returns the options for stopping a router; a negative timeout keeps the graceful timeout the container was created with
+func stopOptions(timeout int) container.StopOptions {
+	if timeout < 0 {
+		return container.StopOptions{}
+	}
+	return container.StopOptions{Timeout: &timeout}
+}
+
+// RemoveRouter stops a router gracefully, removes its container, volume and NAT gateway and stops tracking it.
+// A negative timeout waits as long as the router kind needs to shut down cleanly.
+func (t *Testnet) RemoveRouter(ctx context.Context, r state.Router, timeout int) error {
+	log.WithFields(map[string]interface{}{
+		"routerID":    r.ID,
+		"containerID": r.ContainerID,
+	}).Debug("Removing router")
+
+	if err := t.cli.ContainerStop(ctx, r.ContainerID, stopOptions(timeout)); err != nil && !client.IsErrNotFound(err) {
+		log.WithError(err).Error("Failed to stop router container")
+		return fmt.Errorf("error stopping router %s: %v", r.Name, err)
+	}
+	if err := t.cli.ContainerRemove(ctx, r.ContainerID, container.RemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+		log.WithError(err).Error("Failed to remove router container")
+		return fmt.Errorf("error removing router %s: %v", r.Name, err)
+	}
+	// The container is gone, so stop tracking it even if its volume or NAT gateway can't be removed
+	t.untrack(r)
+	if err := t.cli.VolumeRemove(ctx, r.VolumeName, true); err != nil && !client.IsErrNotFound(err) {
+		log.WithError(err).Error("Failed to remove router volume")
+		return fmt.Errorf("error removing volume %s of router %s: %v", r.VolumeName, r.Name, err)
+	}
+	if err := t.removeNAT(ctx, r); err != nil {
+		log.WithError(err).Error("Failed to remove NAT gateway")
+		return err
+	}
+
+	log.WithField("routerID", r.ID).Debug("Successfully removed router")
+	return nil
+}
+
+// RestartRouter restarts a router, shutting it down gracefully first
+func (t *Testnet) RestartRouter(ctx context.Context, r state.Router, timeout int) error {
+	err := t.routerAction("restart", r, func() error {
+		return t.cli.ContainerRestart(ctx, r.ContainerID, stopOptions(timeout))
+	})
+	if err != nil {
+		return err
+	}
+	return t.applyNetwork(ctx, r)
+}
+
+// StopRouter stops a router gracefully and keeps its data, so it can be started again
+func (t *Testnet) StopRouter(ctx context.Context, r state.Router, timeout int) error {
+	return t.routerAction("stop", r, func() error {
+		return t.cli.ContainerStop(ctx, r.ContainerID, stopOptions(timeout))
+	})
+}
+
+// StartRouter starts a stopped router again
+func (t *Testnet) StartRouter(ctx context.Context, r state.Router) error {
+	err := t.routerAction("start", r, func() error {
+		return t.cli.ContainerStart(ctx, r.ContainerID, container.StartOptions{})
+	})
+	if err != nil {
+		return err
+	}
+	return t.applyNetwork(ctx, r)
+}
+
+// PauseRouter freezes every process of a router
+func (t *Testnet) PauseRouter(ctx context.Context, r state.Router) error {
+	return t.routerAction("pause", r, func() error {
+		return t.cli.ContainerPause(ctx, r.ContainerID)
+	})
+}
+
+// UnpauseRouter resumes a paused router
+func (t *Testnet) UnpauseRouter(ctx context.Context, r state.Router) error {
+	return t.routerAction("unpause", r, func() error {
+		return t.cli.ContainerUnpause(ctx, r.ContainerID)
+	})
+}
+
+// routerAction runs a lifecycle operation on a single router container
+func (t *Testnet) routerAction(action string, r state.Router, run func() error) error {
+	log.WithFields(map[string]interface{}{
+		"action":      action,
+		"routerID":    r.ID,
+		"containerID": r.ContainerID,
+	}).Debug("Running router lifecycle action")
+	if err := run(); err != nil {
+		log.WithError(err).Error("Router lifecycle action failed")
+		return fmt.Errorf("error running %s on router %s: %v", action, r.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/state"
+	"strings"
+)
+
+// RouterStatus is a router container as Docker reports it
+type RouterStatus struct {
+	ID          int    `json:"id,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+	IP          string `json:"ip,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	ContainerID string `json:"container_id"`
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	// Version is what the router's image was built at: a git ref, release or commit
+	Version string `json:"version"`
+	State   string `json:"state"`
+	Status  string `json:"status"`
+	Ready   bool   `json:"ready"`
+	// NotReady says why a router is not ready yet
+	NotReady string `json:"not_ready,omitempty"`
+	// NAT is the kind of NAT the router is behind, IP is then its gateway's address
+	NAT string `json:"nat,omitempty"`
+}
+
+// Status lists the router containers of the testnet, running and stopped
+func (t *Testnet) Status(ctx context.Context) ([]RouterStatus, error) {
+	log.Debug("Fetching status of router containers")
+	containers, err := t.cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: docker_control.RouterFilter(t.ID()),
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to list Docker containers")
+		return nil, fmt.Errorf("failed to list Docker containers: %v", err)
+	}
+
+	tracked := make(map[string]state.Router)
+	for _, r := range t.Routers() {
+		tracked[r.ContainerID] = r
+	}
+
+	var routers []RouterStatus
+	for _, c := range containers {
+		r, ok := tracked[c.ID]
+		status := RouterStatus{
+			ID:          r.ID,
+			Kind:        c.Labels[docker_control.LABEL_KIND],
+			IP:          r.IP,
+			IPv6:        r.IPv6,
+			ContainerID: c.ID[:12],
+			Name:        ContainerName(c),
+			Image:       c.Image,
+			Version:     imageVersion(c),
+			State:       c.State,
+			Status:      c.Status,
+		}
+		if r.NAT != nil {
+			status.NAT = r.Options.NAT
+		}
+		if ok {
+			readiness, err := t.RouterReady(ctx, r, false)
+			if err != nil {
+				log.WithError(err).Warn("Failed to check router readiness")
+				status.NotReady = err.Error()
+			} else {
+				status.Ready = readiness.Ready
+				status.NotReady = readiness.Reason()
+			}
+		}
+		routers = append(routers, status)
+	}
+	return routers, nil
+}
+
+// imageVersion returns the version a router container's image was built at, images built before versions were recorded are latest
+func imageVersion(c types.Container) string {
+	if version := c.Labels[docker_control.LABEL_VERSION]; version != "" {
+		return version
+	}
+	return docker_control.VERSION_LATEST
+}
+
+// ContainerName returns a listed container's name without Docker's leading "/"
+func ContainerName(c types.Container) string {
+	if len(c.Names) == 0 {
+		return c.ID[:12]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
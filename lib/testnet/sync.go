@@ -0,0 +1,133 @@
+package testnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-i2p/go-i2p/lib/common/base64"
+	"github.com/go-i2p/go-i2p/lib/common/router_info"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"os"
+	"strings"
+)
+
+// SHARED_NETDB is the directory of the shared volume every router's RouterInfo is collected in,
+// routers see it below docker_control.SHARED_DIR
+const SHARED_NETDB = "netDb"
+
+// netDbEntry returns where a RouterInfo goes in a netDb: its r<X> directory and routerInfo-<hash>.dat file name
+func netDbEntry(routerInfo []byte) (string, error) {
+	ri, _, err := router_info.ReadRouterInfo(routerInfo)
+	if err != nil {
+		return "", fmt.Errorf("error parsing RouterInfo: %v", err)
+	}
+	identHash := ri.IdentHash()
+	encodedHash := base64.EncodeToString(identHash[:])
+	return "r" + encodedHash[:1] + "/routerInfo-" + encodedHash + ".dat", nil
+}
+
+// SyncToShared copies every router's RouterInfo into the shared netDb.
+// Routers of kinds that don't write their RouterInfo to disk are skipped.
+func (t *Testnet) SyncToShared(ctx context.Context) error {
+	if !t.Running() {
+		return fmt.Errorf("testnet %s isn't running", t.Name())
+	}
+	log.Debug("Syncing RouterInfos from all router containers to the shared volume")
+
+	routers := t.Routers()
+	files := map[string][]byte{}
+	failed := 0
+	for _, r := range routers {
+		k, ok := nodekind.Lookup(r.Kind)
+		if !ok || k.RouterInfoPath() == "" {
+			log.WithField("router", r.Name).Debug("Router does not write a RouterInfo, skipping")
+			continue
+		}
+		routerInfo, err := docker_control.ContainerFS(t.cli, r.ContainerID, "/").ReadFile(ctx, k.RouterInfoPath())
+		if err == nil {
+			var entry string
+			if entry, err = netDbEntry(routerInfo); err == nil {
+				files[SHARED_NETDB+"/"+entry] = routerInfo
+				continue
+			}
+		}
+		failed++
+		log.WithFields(map[string]interface{}{
+			"router": r.Name,
+			"error":  err,
+		}).Error("Failed to read RouterInfo")
+	}
+
+	if len(files) > 0 {
+		if err := docker_control.WriteVolumeFiles(t.cli, ctx, t.Ref(), t.SharedVolume(), files); err != nil {
+			return fmt.Errorf("error writing RouterInfos to the shared volume: %v", err)
+		}
+	}
+	log.WithField("routerInfos", len(files)).Debug("Synced RouterInfos to the shared volume")
+	if failed > 0 {
+		return fmt.Errorf("failed to sync netDb from %d of %d routers", failed, len(routers))
+	}
+	return nil
+}
+
+// SyncFromShared copies the shared netDb into every router's netDb
+func (t *Testnet) SyncFromShared(ctx context.Context) error {
+	if !t.Running() {
+		return fmt.Errorf("testnet %s isn't running", t.Name())
+	}
+	log.Debug("Syncing netDb from shared volume to all router containers")
+
+	routers := t.Routers()
+	if len(routers) == 0 {
+		return nil
+	}
+	shared, err := docker_control.ReadVolumeDir(t.cli, ctx, t.Ref(), t.SharedVolume(), SHARED_NETDB)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Debug("Shared netDb is empty, nothing to sync")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading the shared netDb: %v", err)
+	}
+
+	failed := 0
+	for _, r := range routers {
+		k, ok := nodekind.Lookup(r.Kind)
+		if !ok {
+			failed++
+			log.WithField("router", r.Name).Errorf("Unknown router kind %q", r.Kind)
+			continue
+		}
+		files := make(map[string][]byte, len(shared))
+		for entry, content := range shared {
+			// Only the RouterInfos, whatever else a router may have left in the shared netDb
+			if strings.HasPrefix(entry, "r") && strings.Contains(entry, "/routerInfo-") {
+				files[entry] = content
+			}
+		}
+		log.WithFields(map[string]interface{}{
+			"router":      r.Name,
+			"routerInfos": len(files),
+		}).Debug("Syncing netDb from shared volume to container")
+		if err := docker_control.ContainerFS(t.cli, r.ContainerID, k.NetDbPath()).WriteFiles(ctx, files); err != nil {
+			failed++
+			log.WithFields(map[string]interface{}{
+				"router": r.Name,
+				"error":  err,
+			}).Error("Failed to sync netDb to container")
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to sync netDb to %d of %d routers", failed, len(routers))
+	}
+	return nil
+}
+
+// SyncNetDb makes every router know every other router by exchanging RouterInfos through the shared volume
+func (t *Testnet) SyncNetDb(ctx context.Context) error {
+	if err := t.SyncToShared(ctx); err != nil {
+		return err
+	}
+	return t.SyncFromShared(ctx)
+}
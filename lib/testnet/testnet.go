@@ -0,0 +1,582 @@
+package testnet
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/topology"
+	"go-i2p-testnet/lib/utils/logger"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var log = logger.GetTestnetLogger()
+
+// Testnet is an isolated I2P network of router containers on one Docker host.
+// All methods are safe for concurrent use.
+type Testnet struct {
+	cli *client.Client
+
+	mu           sync.Mutex
+	ref          docker_control.TestnetRef
+	running      bool
+	networkID    string
+	subnet       string
+	sharedVolume string
+	routers      []state.Router
+	// containers and volumes are every Docker resource that has to be removed on Stop
+	containers   []string
+	volumes      []string
+	nextRouterID int
+	// requestedSubnet is the subnet Start creates the network on, the first free /16 if empty
+	requestedSubnet string
+	// ipam hands out the router addresses in subnet while the testnet is running
+	ipam *docker_control.IPAM
+	// dualStack makes Start create a network with IPv6 as well, on requestedSubnet6 or a random ULA subnet
+	dualStack        bool
+	requestedSubnet6 string
+	// subnet6 is the IPv6 subnet of a dual-stack network, ipam6 hands out its addresses
+	subnet6 string
+	ipam6   *docker_control.IPAM
+	// partition maps each group to the names of its routers while the testnet is partitioned
+	partition map[string][]string
+	// partitionMu serialises changes to the routes of the routers, so the last change sees the latest partition
+	partitionMu sync.Mutex
+	// networks are the private networks of routers behind a NAT and the publish network, removed on Stop after the containers
+	networks []string
+	// natMu serialises creating the networks of routers behind a NAT, which all pick their subnets from the same list
+	natMu sync.Mutex
+	// publishMu makes sure only one router creates the publish network
+	publishMu sync.Mutex
+}
+
+// New returns a testnet with the given name that has not been started yet
+func New(cli *client.Client, name string) (*Testnet, error) {
+	if err := docker_control.ValidateTestnetName(name); err != nil {
+		return nil, err
+	}
+	return &Testnet{
+		cli:          cli,
+		ref:          docker_control.TestnetRef{Name: name},
+		nextRouterID: 1,
+	}, nil
+}
+
+// FromState returns the running testnet recorded in s, without checking it against Docker
+func FromState(cli *client.Client, s *state.State) *Testnet {
+	t := &Testnet{
+		cli:          cli,
+		ref:          docker_control.TestnetRef{ID: s.ID, Name: s.Name},
+		running:      true,
+		networkID:    s.NetworkID,
+		subnet:       s.Subnet,
+		subnet6:      s.Subnet6,
+		sharedVolume: s.SharedVolume,
+		routers:      s.Routers,
+		containers:   s.Containers,
+		volumes:      s.Volumes,
+		// State written before router IDs were persisted only has the routers themselves to go by
+		nextRouterID: s.NextRouterID,
+		partition:    s.Partition,
+		networks:     s.Networks,
+	}
+	if t.ref.Name == "" {
+		t.ref.Name = s.NetworkName
+	}
+	for _, r := range s.Routers {
+		if r.ID >= t.nextRouterID {
+			t.nextRouterID = r.ID + 1
+		}
+	}
+	if t.nextRouterID < 1 {
+		t.nextRouterID = 1
+	}
+
+	// State written before addresses were recorded only has the routers to go by
+	addresses, last := s.Addresses, s.LastAddress
+	if addresses == nil {
+		addresses = map[string]string{}
+		for _, r := range s.Routers {
+			addresses[r.IP] = r.Name
+			last = r.IP
+			if r.IPv6 != "" {
+				addresses[r.IPv6] = r.Name
+			}
+		}
+	}
+	ipam, err := docker_control.NewIPAM(s.Subnet, addresses, last)
+	if err != nil {
+		log.WithError(err).Error("Failed to restore address allocations, no routers can be added")
+	}
+	t.ipam = ipam
+	if s.Subnet6 != "" {
+		t.dualStack = true
+		if t.ipam6, err = docker_control.NewIPAM(s.Subnet6, addresses, s.LastAddress6); err != nil {
+			log.WithError(err).Error("Failed to restore IPv6 address allocations, no routers can be added")
+			t.ipam = nil
+		}
+	}
+	return t
+}
+
+// State captures the testnet for persisting, see FromState
+func (t *Testnet) State() *state.State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &state.State{
+		ID:           t.ref.ID,
+		Name:         t.ref.Name,
+		NetworkName:  t.ref.NetworkName(),
+		Subnet:       t.subnet,
+		Subnet6:      t.subnet6,
+		NetworkID:    t.networkID,
+		SharedVolume: t.sharedVolume,
+		Routers:      append([]state.Router(nil), t.routers...),
+		Containers:   append([]string(nil), t.containers...),
+		Volumes:      append([]string(nil), t.volumes...),
+		NextRouterID: t.nextRouterID,
+		Addresses:    t.addresses(),
+		LastAddress:  lastAddress(t.ipam),
+		LastAddress6: lastAddress(t.ipam6),
+		Partition:    copyPartition(t.partition),
+		Networks:     append([]string(nil), t.networks...),
+	}
+}
+
+// addresses returns the handed out addresses of both families with their owners, the caller holds t.mu
+func (t *Testnet) addresses() map[string]string {
+	if t.ipam == nil {
+		return nil
+	}
+	addresses := t.ipam.Allocations()
+	if t.ipam6 != nil {
+		for addr, owner := range t.ipam6.Allocations() {
+			addresses[addr] = owner
+		}
+	}
+	return addresses
+}
+
+// lastAddress returns the address an allocator handed out most recently
+func lastAddress(ipam *docker_control.IPAM) string {
+	if ipam == nil {
+		return ""
+	}
+	return ipam.Last()
+}
+
+// Client returns the Docker client the testnet is managed with
+func (t *Testnet) Client() *client.Client {
+	return t.cli
+}
+
+// Ref identifies the testnet and prefixes the names of its Docker resources
+func (t *Testnet) Ref() docker_control.TestnetRef {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ref
+}
+
+// Name returns the testnet name
+func (t *Testnet) Name() string {
+	return t.Ref().Name
+}
+
+// ID returns the ID every Docker resource of the testnet is labelled with, empty until the testnet is started
+func (t *Testnet) ID() string {
+	return t.Ref().ID
+}
+
+// NetworkName returns the name of the testnet's Docker network
+func (t *Testnet) NetworkName() string {
+	return t.Ref().NetworkName()
+}
+
+// Subnet returns the subnet of the testnet's Docker network
+func (t *Testnet) Subnet() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.subnet
+}
+
+// SetSubnet chooses the subnet, in CIDR notation, that Start creates the network on instead of the first free /16
+func (t *Testnet) SetSubnet(subnet string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running {
+		return fmt.Errorf("testnet %s is already running on subnet %s", t.ref.Name, t.subnet)
+	}
+	prefix, err := docker_control.ParseSubnet(subnet)
+	if err != nil {
+		return err
+	}
+	if !prefix.Addr().Is4() {
+		return fmt.Errorf("subnet %s is not an IPv4 subnet", subnet)
+	}
+	t.requestedSubnet = prefix.String()
+	return nil
+}
+
+// Subnet6 returns the IPv6 subnet of a dual-stack testnet, empty if the testnet is IPv4-only
+func (t *Testnet) Subnet6() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.subnet6
+}
+
+// DualStack reports whether the testnet network has IPv6 besides IPv4
+func (t *Testnet) DualStack() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dualStack
+}
+
+// SetIPv6 makes Start create a dual-stack network with the given IPv6 subnet in CIDR notation, or a random
+// unique local /64 if subnet is empty
+func (t *Testnet) SetIPv6(subnet string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running {
+		return fmt.Errorf("testnet %s is already running", t.ref.Name)
+	}
+	if subnet != "" {
+		prefix, err := docker_control.ParseSubnet(subnet)
+		if err != nil {
+			return err
+		}
+		if !prefix.Addr().Is6() {
+			return fmt.Errorf("subnet %s is not an IPv6 subnet", subnet)
+		}
+		subnet = prefix.String()
+	}
+	t.dualStack = true
+	t.requestedSubnet6 = subnet
+	return nil
+}
+
+// SharedVolume returns the name of the volume routers exchange their RouterInfos through
+func (t *Testnet) SharedVolume() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sharedVolume
+}
+
+// Running reports whether the testnet has been started and not stopped since
+func (t *Testnet) Running() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.running
+}
+
+// Start creates the testnet's Docker network and shared volume
+func (t *Testnet) Start(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running {
+		return fmt.Errorf("testnet %s is already running", t.ref.Name)
+	}
+	log.Debug("Starting testnet initialization")
+	if err := docker_control.PullHelperImage(t.cli, ctx); err != nil {
+		return fmt.Errorf("error getting the helper image: %v", err)
+	}
+	t.ref.ID = docker_control.NewTestnetID()
+
+	// Create Docker network
+	networkName := t.ref.NetworkName()
+	log.WithFields(map[string]interface{}{
+		"networkName": networkName,
+		"subnet":      t.requestedSubnet,
+		"subnet6":     t.requestedSubnet6,
+	}).Debug("Creating Docker network")
+	networkID, subnet, subnet6, err := docker_control.CreateDockerNetwork(t.cli, ctx, t.ref, t.requestedSubnet, t.dualStack, t.requestedSubnet6)
+	if err != nil {
+		log.WithError(err).Error("Failed to create Docker network")
+		return fmt.Errorf("error creating Docker network: %v", err)
+	}
+	log.WithFields(map[string]interface{}{
+		"networkName": networkName,
+		"networkID":   networkID,
+		"subnet":      subnet,
+		"subnet6":     subnet6,
+	}).Debug("Successfully created network")
+	ipam, err := docker_control.NewIPAM(subnet, nil, "")
+	var ipam6 *docker_control.IPAM
+	if err == nil && subnet6 != "" {
+		ipam6, err = docker_control.NewIPAM(subnet6, nil, "")
+	} else if err == nil && t.dualStack {
+		err = fmt.Errorf("network %s has no IPv6 subnet", networkName)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to set up address allocation")
+		if rerr := t.cli.NetworkRemove(ctx, networkID); rerr != nil {
+			log.WithError(rerr).Error("Failed to remove network after failed start")
+		}
+		return fmt.Errorf("error setting up address allocation: %v", err)
+	}
+
+	//Create shared volume
+	log.Debug("Creating shared volume")
+	sharedVolume, err := docker_control.CreateSharedVolume(t.cli, ctx, t.ref)
+	if err != nil {
+		log.WithError(err).Error("Failed to create shared volume")
+		// Nothing else exists yet, so don't leave the network behind
+		if rerr := t.cli.NetworkRemove(ctx, networkID); rerr != nil {
+			log.WithError(rerr).Error("Failed to remove network after failed start")
+		}
+		return fmt.Errorf("error creating shared volume: %v", err)
+	}
+	log.WithField("volumeName", sharedVolume).Debug("Successfully created shared volume")
+
+	t.networkID = networkID
+	t.subnet = subnet
+	t.ipam = ipam
+	t.subnet6 = subnet6
+	t.ipam6 = ipam6
+	t.sharedVolume = sharedVolume
+	t.volumes = append(t.volumes, sharedVolume)
+	t.running = true
+	return nil
+}
+
+// Stop removes every container, volume and the network of the testnet.
+// Removal carries on past failures, the first of which is returned. The subnets and IPv6 chosen with SetSubnet and
+// SetIPv6 are forgotten as well, so the next Start uses the defaults unless they are set again.
+func (t *Testnet) Stop(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	networkName := t.ref.NetworkName()
+	log.WithField("networkName", networkName).Debug("Starting cleanup of Docker resources")
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Remove containers
+	for _, containerID := range t.containers {
+		log.WithField("containerID", containerID).Debug("Attempting to stop container")
+		// Attempt to stop the container
+		timeout := 10 // seconds
+		err := t.cli.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout})
+		if err != nil && !client.IsErrNotFound(err) {
+			log.WithFields(map[string]interface{}{
+				"containerID": containerID,
+				"error":       err,
+			}).Error("Failed to stop container")
+		}
+
+		// Attempt to remove the container
+		log.WithField("containerID", containerID).Debug("Attempting to remove container")
+		err = t.cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			log.WithFields(map[string]interface{}{
+				"containerID": containerID,
+				"error":       err,
+			}).Error("Failed to remove container")
+			fail(fmt.Errorf("error removing container %s: %v", containerID, err))
+		} else {
+			log.WithField("containerID", containerID).Debug("Successfully removed container")
+		}
+	}
+
+	// Remove volumes
+	for _, volumeName := range t.volumes {
+		log.WithField("volumeName", volumeName).Debug("Attempting to remove volume")
+		err := t.cli.VolumeRemove(ctx, volumeName, true)
+		if err != nil && !client.IsErrNotFound(err) {
+			log.WithFields(map[string]interface{}{
+				"volumeName": volumeName,
+				"error":      err,
+			}).Error("Failed to remove volume")
+			fail(fmt.Errorf("error removing volume %s: %v", volumeName, err))
+		} else {
+			log.WithField("volumeName", volumeName).Debug("Successfully removed volume")
+		}
+	}
+
+	// Remove the networks of routers behind a NAT and the publish network, their containers are gone now
+	for _, name := range t.networks {
+		log.WithField("networkName", name).Debug("Attempting to remove network")
+		err := t.cli.NetworkRemove(ctx, name)
+		if err != nil && !client.IsErrNotFound(err) {
+			log.WithFields(map[string]interface{}{
+				"networkName": name,
+				"error":       err,
+			}).Error("Failed to remove network")
+			fail(fmt.Errorf("error removing network %s: %v", name, err))
+		}
+	}
+
+	// Remove network
+	log.WithField("networkName", networkName).Debug("Attempting to remove network")
+	err := t.cli.NetworkRemove(ctx, networkName)
+	if err != nil && !client.IsErrNotFound(err) {
+		log.WithFields(map[string]interface{}{
+			"networkName": networkName,
+			"error":       err,
+		}).Error("Failed to remove network")
+		fail(fmt.Errorf("error removing network %s: %v", networkName, err))
+	} else {
+		log.WithField("networkName", networkName).Debug("Successfully removed network")
+	}
+
+	t.running = false
+	t.routers = nil
+	t.containers = nil
+	t.volumes = nil
+	t.nextRouterID = 1
+	t.ipam = nil
+	t.ipam6 = nil
+	t.subnet = ""
+	t.subnet6 = ""
+	t.requestedSubnet = ""
+	t.dualStack = false
+	t.requestedSubnet6 = ""
+	t.partition = nil
+	t.networks = nil
+	return firstErr
+}
+
+// Routers returns the routers of the testnet in the order they were added
+func (t *Testnet) Routers() []state.Router {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]state.Router(nil), t.routers...)
+}
+
+// Router looks up a router by its ID, container name (with or without the testnet prefix) or container ID prefix
+func (t *Testnet) Router(node string) (state.Router, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if id, err := strconv.Atoi(node); err == nil {
+		for _, r := range t.routers {
+			if r.ID == id {
+				return r, nil
+			}
+		}
+		return state.Router{}, fmt.Errorf("no router with ID %d", id)
+	}
+	for _, r := range t.routers {
+		if r.Name == node || r.Name == t.ref.ResourceName(node) {
+			return r, nil
+		}
+	}
+	var matches []state.Router
+	for _, r := range t.routers {
+		if strings.HasPrefix(r.ContainerID, node) {
+			matches = append(matches, r)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return state.Router{}, fmt.Errorf("no router named %q", node)
+	case 1:
+		return matches[0], nil
+	default:
+		return state.Router{}, fmt.Errorf("container ID prefix %q matches %d routers", node, len(matches))
+	}
+}
+
+// Topology describes the routers of the testnet in topology file form
+func (t *Testnet) Topology() *topology.Topology {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	top := &topology.Topology{}
+	for _, r := range t.routers {
+		top.Append(r.Kind, r.Options)
+	}
+	return top
+}
+
+// track records a newly created router together with its container and volume, and its NAT gateway if it has one
+func (t *Testnet) track(r state.Router) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	log.WithFields(map[string]interface{}{
+		"routerID":    r.ID,
+		"containerID": r.ContainerID,
+		"volumeID":    r.VolumeName,
+	}).Debug("Tracking new container and volume")
+	t.routers = append(t.routers, r)
+	t.containers = append(t.containers, r.ContainerID)
+	t.volumes = append(t.volumes, r.VolumeName)
+	if r.NAT != nil {
+		t.containers = append(t.containers, r.NAT.ContainerID)
+		t.networks = append(t.networks, r.NAT.Network)
+	}
+	if len(t.partition) > 0 {
+		t.partition[REST_GROUP] = append(t.partition[REST_GROUP], r.Name)
+	}
+}
+
+// untrack forgets a router and its container and volume, and its NAT gateway if it has one
+func (t *Testnet) untrack(r state.Router) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.forgetRouter(r)
+	t.containers = removeString(t.containers, r.ContainerID)
+	t.volumes = removeString(t.volumes, r.VolumeName)
+	if r.NAT != nil {
+		t.containers = removeString(t.containers, r.NAT.ContainerID)
+		t.networks = removeString(t.networks, r.NAT.Network)
+	}
+}
+
+// forgetRouter stops tracking a router, releases its addresses and takes it out of its partition group, but keeps
+// its volume and NAT gateway tracked so Stop still removes them. The caller holds t.mu.
+func (t *Testnet) forgetRouter(r state.Router) {
+	routers := t.routers[:0]
+	for _, tracked := range t.routers {
+		if tracked.ID != r.ID {
+			routers = append(routers, tracked)
+		}
+	}
+	t.routers = routers
+	t.releaseAddress(r.IP)
+	t.releaseAddress(r.IPv6)
+	if r.NAT != nil {
+		t.releaseAddress(r.NAT.IPv6)
+	}
+	for group, names := range t.partition {
+		if names = removeString(names, r.Name); len(names) > 0 {
+			t.partition[group] = names
+		} else {
+			delete(t.partition, group)
+		}
+	}
+}
+
+// update replaces the record of a tracked router, e.g. after its options changed
+func (t *Testnet) update(r state.Router) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.routers {
+		if t.routers[i].ID == r.ID {
+			t.routers[i] = r
+		}
+	}
+}
+
+// releaseAddress returns a router's address to the free pool, the caller holds t.mu
+func (t *Testnet) releaseAddress(ip string) {
+	for _, ipam := range []*docker_control.IPAM{t.ipam, t.ipam6} {
+		if ipam != nil {
+			ipam.Release(ip)
+		}
+	}
+}
+
+func removeString(list []string, value string) []string {
+	kept := list[:0]
+	for _, item := range list {
+		if item != value {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
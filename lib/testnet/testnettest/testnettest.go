@@ -0,0 +1,198 @@
+// Package testnettest starts throwaway testnets from Go tests.
+//
+//	func TestInterop(t *testing.T) {
+//		net := testnettest.New(t, testnettest.Routers{GoI2P: 2, I2PD: 3})
+//		...
+//	}
+//
+// The testnet is removed again when the test finishes, and the logs of every router are
+// written to the test log if the test failed. Tests are skipped when Docker is not reachable.
+package testnettest
+
+import (
+	"context"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/testnet"
+	"go-i2p-testnet/lib/topology"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// DEFAULT_READY_TIMEOUT is how long New waits for the routers to become ready
+	DEFAULT_READY_TIMEOUT = 5 * time.Minute
+	// DEFAULT_LOG_TAIL is how many lines of each router's log are dumped when a test fails
+	DEFAULT_LOG_TAIL = 200
+	// maxNameLength keeps generated testnet names, and the container names derived from them, readable
+	maxNameLength = 40
+)
+
+// Routers says how many routers of each kind the testnet gets
+type Routers struct {
+	GoI2P int
+	I2PD  int
+	Java  int
+	// Kinds adds routers of any other registered kind, keyed by kind name
+	Kinds map[string]int
+}
+
+// specs lists the routers to create, in a stable order
+func (r Routers) specs() []testnet.RouterSpec {
+	var specs []testnet.RouterSpec
+	for i := 0; i < r.GoI2P; i++ {
+		specs = append(specs, testnet.RouterSpec{Kind: topology.KindGoI2P})
+	}
+	for i := 0; i < r.I2PD; i++ {
+		specs = append(specs, testnet.RouterSpec{Kind: topology.KindI2PD})
+	}
+	for i := 0; i < r.Java; i++ {
+		specs = append(specs, testnet.RouterSpec{Kind: topology.KindJava})
+	}
+	kinds := make([]string, 0, len(r.Kinds))
+	for kind := range r.Kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		for i := 0; i < r.Kinds[kind]; i++ {
+			specs = append(specs, testnet.RouterSpec{Kind: kind})
+		}
+	}
+	return specs
+}
+
+type config struct {
+	readyTimeout time.Duration
+	parallel     int
+	logTail      int
+	tunnels      bool
+}
+
+// Option changes how New sets up the testnet
+type Option func(*config)
+
+// WithReadyTimeout sets how long New waits for the routers to become ready
+func WithReadyTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.readyTimeout = d
+	}
+}
+
+// WithParallel sets how many routers are created at the same time
+func WithParallel(n int) Option {
+	return func(c *config) {
+		c.parallel = n
+	}
+}
+
+// WithTunnels makes New also wait until every router that can report it has built a tunnel
+func WithTunnels() Option {
+	return func(c *config) {
+		c.tunnels = true
+	}
+}
+
+// WithLogTail sets how many lines of each router's log are dumped when the test fails, 0 dumps none
+func WithLogTail(lines int) Option {
+	return func(c *config) {
+		c.logTail = lines
+	}
+}
+
+// New starts a testnet with the given routers and blocks until all of them are ready.
+// The testnet is stopped and removed by tb.Cleanup; any failure to set it up fails the test.
+func New(tb testing.TB, routers Routers, opts ...Option) *testnet.Testnet {
+	tb.Helper()
+	c := config{
+		readyTimeout: DEFAULT_READY_TIMEOUT,
+		parallel:     testnet.DEFAULT_PARALLEL,
+		logTail:      DEFAULT_LOG_TAIL,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		tb.Fatalf("testnettest: creating Docker client: %v", err)
+	}
+	if _, err := cli.Ping(ctx); err != nil {
+		cli.Close()
+		tb.Skipf("testnettest: Docker is not available: %v", err)
+	}
+
+	net, err := testnet.New(cli, testnetName(tb))
+	if err != nil {
+		cli.Close()
+		tb.Fatalf("testnettest: %v", err)
+	}
+	if err := net.Start(ctx); err != nil {
+		cli.Close()
+		tb.Fatalf("testnettest: starting testnet: %v", err)
+	}
+	// Registered before any router exists, so a failed setup is cleaned up as well
+	tb.Cleanup(func() {
+		if tb.Failed() && c.logTail > 0 {
+			dumpLogs(tb, net, c.logTail)
+		}
+		if err := net.Stop(context.Background()); err != nil {
+			tb.Errorf("testnettest: removing testnet %s: %v", net.Name(), err)
+		}
+		cli.Close()
+	})
+
+	if _, err := net.AddRouters(ctx, routers.specs(), c.parallel, nil); err != nil {
+		tb.Fatalf("testnettest: adding routers: %v", err)
+	}
+
+	readyCtx, cancel := context.WithTimeout(ctx, c.readyTimeout)
+	defer cancel()
+	if err := net.WaitReady(readyCtx, c.tunnels); err != nil {
+		tb.Fatalf("testnettest: %v", err)
+	}
+	return net
+}
+
+// dumpLogs writes the end of every router's log to the test log
+func dumpLogs(tb testing.TB, net *testnet.Testnet, tail int) {
+	tb.Helper()
+	for _, r := range net.Routers() {
+		entries, err := net.LogEntries(context.Background(), r, strconv.Itoa(tail))
+		if err != nil {
+			tb.Logf("testnettest: %v", err)
+			continue
+		}
+		lines := make([]string, len(entries))
+		errors, warnings := 0, 0
+		for i, entry := range entries {
+			lines[i] = entry.Line
+			switch entry.Level {
+			case nodekind.LEVEL_ERROR:
+				errors++
+			case nodekind.LEVEL_WARN:
+				warnings++
+			}
+		}
+		tb.Logf("=== logs of %s (%s, %s): %d errors, %d warnings ===\n%s", r.Name, r.Kind, r.IP, errors, warnings, strings.Join(lines, "\n"))
+	}
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// testnetName derives a unique testnet name from the test name, so parallel tests and
+// leftovers of aborted runs never collide
+func testnetName(tb testing.TB) string {
+	name := invalidNameChars.ReplaceAllString(tb.Name(), "-")
+	suffix := "-" + docker_control.NewTestnetID()[:6]
+	if len(name) > maxNameLength-len(suffix) {
+		name = name[:maxNameLength-len(suffix)]
+	}
+	return "test-" + name + suffix
+}
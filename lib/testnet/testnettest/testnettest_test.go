@@ -0,0 +1,73 @@
+package testnettest
+
+import (
+	"go-i2p-testnet/lib/topology"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoutersSpecs(t *testing.T) {
+	routers := Routers{GoI2P: 1, I2PD: 2, Java: 1, Kinds: map[string]int{"zeta": 1, "alpha": 2, "none": 0}}
+	want := []string{topology.KindGoI2P, topology.KindI2PD, topology.KindI2PD, topology.KindJava, "alpha", "alpha", "zeta"}
+
+	// Kinds is a map, the order must not depend on its iteration order
+	for run := 0; run < 10; run++ {
+		specs := routers.specs()
+		got := make([]string, len(specs))
+		for i, spec := range specs {
+			got[i] = spec.Kind
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("specs() = %q, want %q", got, want)
+		}
+	}
+	if specs := (Routers{}).specs(); len(specs) != 0 {
+		t.Errorf("specs() of no routers = %v", specs)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	c := config{}
+	for _, opt := range []Option{WithReadyTimeout(time.Minute), WithParallel(3), WithTunnels(), WithLogTail(0)} {
+		opt(&c)
+	}
+	want := config{readyTimeout: time.Minute, parallel: 3, logTail: 0, tunnels: true}
+	if c != want {
+		t.Errorf("options set %+v, want %+v", c, want)
+	}
+}
+
+var validName = regexp.MustCompile(`^test-[a-zA-Z0-9_.-]+-[0-9a-f]{6}$`)
+
+func TestTestnetName(t *testing.T) {
+	for _, name := range []string{"short", "with spaces/and #symbols", strings.Repeat("long", 30)} {
+		t.Run(name, func(t *testing.T) {
+			first, second := testnetName(t), testnetName(t)
+			if !validName.MatchString(first) {
+				t.Errorf("testnetName() = %q, want test-<name>-<id>", first)
+			}
+			if len(first) > len("test-")+maxNameLength {
+				t.Errorf("testnetName() = %q is longer than %d characters", first, len("test-")+maxNameLength)
+			}
+			if first == second {
+				t.Errorf("testnetName() returned %q twice", first)
+			}
+		})
+	}
+}
+
+func TestNewSkipsWithoutDocker(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(t.TempDir(), "docker.sock"))
+	var inner *testing.T
+	t.Run("new", func(t *testing.T) {
+		inner = t
+		New(t, Routers{I2PD: 1})
+		t.Errorf("New() returned without Docker")
+	})
+	if !inner.Skipped() {
+		t.Errorf("New() didn't skip the test without Docker")
+	}
+}
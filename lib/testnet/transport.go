@@ -0,0 +1,16 @@
+package testnet
+
+import (
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/topology"
+)
+
+// routerTransports returns the transports a router with the given options enables and publishes. Behind a
+// symmetric NAT no peer can connect to the router over NTCP2, so it isn't published whatever the options say.
+func routerTransports(opts topology.NodeOptions) nodekind.Transports {
+	ntcp2Published := opts.NTCP2.IsPublished() && opts.NAT != topology.NAT_SYMMETRIC
+	return nodekind.Transports{
+		NTCP2: nodekind.Transport{Enabled: opts.NTCP2.IsEnabled(), Published: ntcp2Published},
+		SSU2:  nodekind.Transport{Enabled: opts.SSU2.IsEnabled(), Published: opts.SSU2.IsPublished()},
+	}
+}
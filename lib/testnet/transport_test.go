@@ -0,0 +1,87 @@
+package testnet
+
+import (
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/topology"
+	"strings"
+	"testing"
+)
+
+// transportOptions returns node options with the transports set as by `add --transports --published-transports`
+func transportOptions(t *testing.T, enabled, published string) topology.NodeOptions {
+	t.Helper()
+	var opts topology.NodeOptions
+	if err := opts.SetTransports(enabled, published); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+func TestRouterTransports(t *testing.T) {
+	all := nodekind.AllTransports()
+	tests := []struct {
+		name string
+		opts topology.NodeOptions
+		want nodekind.Transports
+	}{
+		{"default", topology.NodeOptions{}, all},
+		{"ntcp2 only", transportOptions(t, "ntcp2", ""), nodekind.Transports{NTCP2: nodekind.Transport{Enabled: true, Published: true}}},
+		{"nothing published", transportOptions(t, "", "none"), nodekind.Transports{NTCP2: nodekind.Transport{Enabled: true}, SSU2: nodekind.Transport{Enabled: true}}},
+		{"full-cone NAT", topology.NodeOptions{NAT: topology.NAT_FULL_CONE}, all},
+		{"symmetric NAT", topology.NodeOptions{NAT: topology.NAT_SYMMETRIC}, nodekind.Transports{NTCP2: nodekind.Transport{Enabled: true}, SSU2: all.SSU2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routerTransports(tt.opts); got != tt.want {
+				t.Errorf("routerTransports() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKindRouterBehindSymmetricNAT(t *testing.T) {
+	r := state.Router{
+		ID:      1,
+		Kind:    topology.KindI2PD,
+		IP:      "172.28.0.5",
+		Options: topology.NodeOptions{NAT: topology.NAT_SYMMETRIC},
+		NAT:     &state.NATGateway{RouterIP: "10.100.0.3"},
+	}
+	kr := kindRouter(r)
+	if kr.IP != "10.100.0.3" || kr.NAT != topology.NAT_SYMMETRIC {
+		t.Errorf("kindRouter() = IP %s, NAT %q, want the router's private address and symmetric", kr.IP, kr.NAT)
+	}
+	if kr.Transports.NTCP2.Published {
+		t.Error("NTCP2 is published behind a symmetric NAT, the transports probe would wait for a listener i2pd never opens")
+	}
+}
+
+func TestCheckTransports(t *testing.T) {
+	i2pd, _ := nodekind.Lookup(topology.KindI2PD)
+	goi2p, _ := nodekind.Lookup(topology.KindGoI2P)
+	tests := []struct {
+		name string
+		kind nodekind.NodeKind
+		opts topology.NodeOptions
+		err  string
+	}{
+		{"i2pd default", i2pd, topology.NodeOptions{}, ""},
+		{"i2pd ssu2 only", i2pd, transportOptions(t, "ssu2", ""), ""},
+		{"i2pd nothing published", i2pd, transportOptions(t, "", "none"), ""},
+		{"goi2p default", goi2p, topology.NodeOptions{}, ""},
+		{"goi2p ntcp2 only", goi2p, transportOptions(t, "ntcp2", ""), "always enables and publishes ssu2"},
+		{"no transport", i2pd, topology.NodeOptions{NTCP2: &topology.TransportOptions{Enabled: new(bool)}, SSU2: &topology.TransportOptions{Enabled: new(bool)}}, "at least one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.CheckTransports(tt.kind)
+			if tt.err == "" && err != nil {
+				t.Errorf("CheckTransports() = %v, want no error", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("CheckTransports() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package topology
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Netem describes the link conditions emulated on a router's network interfaces with tc netem
+type Netem struct {
+	// Delay is added to every packet the router sends, e.g. 120ms
+	Delay string `yaml:"delay,omitempty" json:"delay,omitempty"`
+	// Jitter varies the delay by up to this much, e.g. 20ms; it needs a delay
+	Jitter string `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+	// Loss is the percentage of packets dropped, e.g. 2%
+	Loss string `yaml:"loss,omitempty" json:"loss,omitempty"`
+	// Rate limits the bandwidth in tc's units, e.g. 1mbit
+	Rate string `yaml:"rate,omitempty" json:"rate,omitempty"`
+}
+
+var netemRate = regexp.MustCompile(`^(?i)\d+(\.\d+)?(bit|kbit|mbit|gbit|tbit|bps|kbps|mbps|gbps|tbps)$`)
+
+// ParseNetem parses netem options as given on the command line, e.g. "delay 120ms jitter 20ms loss 2% rate 1mbit"
+func ParseNetem(args []string) (*Netem, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, fmt.Errorf("netem options come in pairs: delay <d>, jitter <d>, loss <percent> and rate <rate>")
+	}
+	n := &Netem{}
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch strings.ToLower(args[i]) {
+		case "delay":
+			n.Delay = value
+		case "jitter":
+			n.Jitter = value
+		case "loss":
+			n.Loss = value
+		case "rate":
+			n.Rate = value
+		default:
+			return nil, fmt.Errorf("unknown netem option %q, use delay, jitter, loss or rate", args[i])
+		}
+	}
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// IsZero reports whether no condition is set, i.e. the link is left as it is
+func (n *Netem) IsZero() bool {
+	return n == nil || *n == Netem{}
+}
+
+// tcDuration converts a Go duration such as 120ms to tc's microsecond notation
+func tcDuration(name string, value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return "", fmt.Errorf("invalid netem %s %q, use a duration such as 120ms", name, value)
+	}
+	return fmt.Sprintf("%dus", d.Microseconds()), nil
+}
+
+// Validate checks every condition that is set
+func (n *Netem) Validate() error {
+	_, err := n.Args()
+	return err
+}
+
+// Args returns the parameters of the netem qdisc for tc, e.g. ["delay", "120000us", "20000us", "loss", "2%"]
+func (n *Netem) Args() ([]string, error) {
+	if n.IsZero() {
+		return nil, nil
+	}
+	var args []string
+	if n.Delay != "" {
+		delay, err := tcDuration("delay", n.Delay)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "delay", delay)
+		if n.Jitter != "" {
+			jitter, err := tcDuration("jitter", n.Jitter)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, jitter)
+		}
+	} else if n.Jitter != "" {
+		return nil, fmt.Errorf("netem jitter needs a delay")
+	}
+	if n.Loss != "" {
+		loss, err := strconv.ParseFloat(strings.TrimSuffix(n.Loss, "%"), 64)
+		if err != nil || loss < 0 || loss > 100 {
+			return nil, fmt.Errorf("invalid netem loss %q, use a percentage such as 2%%", n.Loss)
+		}
+		args = append(args, "loss", strconv.FormatFloat(loss, 'f', -1, 64)+"%")
+	}
+	if n.Rate != "" {
+		if !netemRate.MatchString(n.Rate) {
+			return nil, fmt.Errorf("invalid netem rate %q, use a rate such as 1mbit or 500kbit", n.Rate)
+		}
+		args = append(args, "rate", strings.ToLower(n.Rate))
+	}
+	return args, nil
+}
+
+// String returns the conditions in the form ParseNetem accepts
+func (n *Netem) String() string {
+	if n.IsZero() {
+		return "none"
+	}
+	var parts []string
+	for _, opt := range [][2]string{{"delay", n.Delay}, {"jitter", n.Jitter}, {"loss", n.Loss}, {"rate", n.Rate}} {
+		if opt[1] != "" {
+			parts = append(parts, opt[0]+" "+opt[1])
+		}
+	}
+	return strings.Join(parts, " ")
+}
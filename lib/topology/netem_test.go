@@ -0,0 +1,81 @@
+package topology
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNetem(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+		err  string
+	}{
+		{[]string{"delay", "120ms"}, []string{"delay", "120000us"}, ""},
+		{[]string{"delay", "120ms", "jitter", "20ms"}, []string{"delay", "120000us", "20000us"}, ""},
+		{[]string{"jitter", "20ms", "delay", "1s"}, []string{"delay", "1000000us", "20000us"}, ""},
+		{[]string{"loss", "2%"}, []string{"loss", "2%"}, ""},
+		{[]string{"loss", "0.5"}, []string{"loss", "0.5%"}, ""},
+		{[]string{"RATE", "1Mbit"}, []string{"rate", "1mbit"}, ""},
+		{[]string{"delay", "50ms", "loss", "100%", "rate", "2.5kbps"}, []string{"delay", "50000us", "loss", "100%", "rate", "2.5kbps"}, ""},
+		{nil, nil, "pairs"},
+		{[]string{"delay"}, nil, "pairs"},
+		{[]string{"duplicate", "1%"}, nil, "unknown netem option"},
+		{[]string{"delay", "120"}, nil, "invalid netem delay"},
+		{[]string{"delay", "-5ms"}, nil, "invalid netem delay"},
+		{[]string{"delay", "10ms", "jitter", "lots"}, nil, "invalid netem jitter"},
+		{[]string{"jitter", "20ms"}, nil, "needs a delay"},
+		{[]string{"loss", "101%"}, nil, "invalid netem loss"},
+		{[]string{"loss", "-1"}, nil, "invalid netem loss"},
+		{[]string{"rate", "fast"}, nil, "invalid netem rate"},
+		{[]string{"rate", "1mb"}, nil, "invalid netem rate"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			n, err := ParseNetem(tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseNetem() = %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNetem() = %v", err)
+			}
+			args, err := n.Args()
+			if err != nil {
+				t.Fatalf("Args() = %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("Args() = %q, want %q", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetemString(t *testing.T) {
+	var unset *Netem
+	if got := unset.String(); got != "none" {
+		t.Errorf("nil String() = %q, want none", got)
+	}
+	if args, err := unset.Args(); args != nil || err != nil {
+		t.Errorf("nil Args() = %q, %v, want nothing", args, err)
+	}
+	if got := (&Netem{}).String(); got != "none" {
+		t.Errorf("empty String() = %q, want none", got)
+	}
+
+	n := &Netem{Delay: "120ms", Jitter: "20ms", Loss: "2%", Rate: "1mbit"}
+	want := "delay 120ms jitter 20ms loss 2% rate 1mbit"
+	if got := n.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+	parsed, err := ParseNetem(strings.Fields(n.String()))
+	if err != nil {
+		t.Fatalf("ParseNetem(String()) = %v", err)
+	}
+	if *parsed != *n {
+		t.Errorf("ParseNetem(String()) = %+v, want %+v", *parsed, *n)
+	}
+}
@@ -0,0 +1,392 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/utils/logger"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var log = logger.GetTestnetLogger()
+
+// The built-in router kinds, others can be registered with nodekind.Register
+const (
+	KindGoI2P = "goi2p"
+	KindI2PD  = "i2pd"
+	KindJava  = "java"
+)
+
+// The address families a router can use, see NodeOptions.AddressFamily
+const (
+	FAMILY_IPV4 = "ipv4"
+	FAMILY_IPV6 = "ipv6"
+	FAMILY_DUAL = "dual"
+)
+
+// The kinds of NAT a router can be put behind, see NodeOptions.NAT
+const (
+	// NAT_FULL_CONE keeps a router's source ports and forwards everything sent to the public address to the router
+	NAT_FULL_CONE = "full-cone"
+	// NAT_SYMMETRIC picks a random source port for every connection and lets in only replies
+	NAT_SYMMETRIC = "symmetric"
+)
+
+// The transports a router can enable and publish, see NodeOptions.NTCP2 and NodeOptions.SSU2
+const (
+	TRANSPORT_NTCP2 = "ntcp2"
+	TRANSPORT_SSU2  = "ssu2"
+)
+
+// Topology describes every router that makes up a testnet
+type Topology struct {
+	Routers []RouterGroup `yaml:"routers" json:"routers"`
+}
+
+// RouterGroup describes Count routers of the same kind sharing the same options
+type RouterGroup struct {
+	Kind        string `yaml:"kind" json:"kind"`
+	Count       int    `yaml:"count" json:"count"`
+	NodeOptions `yaml:",inline"`
+	// Overrides replaces options for individual routers, keyed by their 1-based index within the group
+	Overrides map[int]NodeOptions `yaml:"overrides,omitempty" json:"overrides,omitempty"`
+}
+
+// NodeOptions are the per-router settings that can be set for a group or overridden for a single node
+type NodeOptions struct {
+	Floodfill *bool `yaml:"floodfill,omitempty" json:"floodfill,omitempty"`
+	// Version pins the router's image: a git ref for go-i2p, a release for i2pd and Java I2P. Empty means latest.
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	// Netem emulates a slow or lossy link on the router's network interfaces
+	Netem *Netem `yaml:"netem,omitempty" json:"netem,omitempty"`
+	// AddressFamily is FAMILY_IPV4, FAMILY_IPV6 or FAMILY_DUAL. Empty means dual on a dual-stack testnet, ipv4 otherwise.
+	AddressFamily string `yaml:"address_family,omitempty" json:"address_family,omitempty"`
+	// NAT puts the router on a private network behind a NAT gateway of this kind, NAT_FULL_CONE or NAT_SYMMETRIC.
+	// Routers behind a NAT only use IPv4.
+	NAT string `yaml:"nat,omitempty" json:"nat,omitempty"`
+	// Publish makes the router's console, proxies and client APIs reachable from the host on auto-assigned ports
+	Publish *bool `yaml:"publish,omitempty" json:"publish,omitempty"`
+	// NTCP2 and SSU2 choose whether the router enables and publishes each transport, unset means it does both.
+	// go-i2p has no transport settings, see CheckTransports.
+	NTCP2 *TransportOptions `yaml:"ntcp2,omitempty" json:"ntcp2,omitempty"`
+	SSU2  *TransportOptions `yaml:"ssu2,omitempty" json:"ssu2,omitempty"`
+}
+
+// TransportOptions chooses whether a router enables and publishes a transport, unset means yes.
+// A router that doesn't publish a transport can still connect out over it.
+type TransportOptions struct {
+	Enabled   *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	Published *bool `yaml:"published,omitempty" json:"published,omitempty"`
+}
+
+// IsEnabled reports whether the transport is enabled
+func (t *TransportOptions) IsEnabled() bool {
+	return t == nil || t.Enabled == nil || *t.Enabled
+}
+
+// IsPublished reports whether the transport is enabled and published
+func (t *TransportOptions) IsPublished() bool {
+	return t.IsEnabled() && (t == nil || t.Published == nil || *t.Published)
+}
+
+// validate checks that a disabled transport isn't published
+func (t *TransportOptions) validate(name string) error {
+	if t != nil && !t.IsEnabled() && t.Published != nil && *t.Published {
+		return fmt.Errorf("transport %s can't be published when it is disabled", name)
+	}
+	return nil
+}
+
+// merge returns t with every setting that is set in override replaced
+func (t *TransportOptions) merge(override *TransportOptions) *TransportOptions {
+	if override == nil {
+		return t
+	}
+	merged := TransportOptions{}
+	if t != nil {
+		merged = *t
+	}
+	if override.Enabled != nil {
+		merged.Enabled = override.Enabled
+	}
+	if override.Published != nil {
+		merged.Published = override.Published
+	}
+	return &merged
+}
+
+// parseTransportList parses a comma-separated list of transports, "none" is the empty list
+func parseTransportList(list string) (map[string]bool, error) {
+	listed := map[string]bool{}
+	if list == "none" {
+		return listed, nil
+	}
+	for _, name := range strings.Split(list, ",") {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case TRANSPORT_NTCP2, TRANSPORT_SSU2:
+			listed[name] = true
+		default:
+			return nil, fmt.Errorf("unknown transport %q, use %s, %s or none", name, TRANSPORT_NTCP2, TRANSPORT_SSU2)
+		}
+	}
+	return listed, nil
+}
+
+// SetTransports sets NTCP2 and SSU2 from comma-separated lists of the enabled and of the published transports, as
+// given on the command line, e.g. "ntcp2,ssu2" and "ssu2". An empty list leaves those settings unset, "none" is
+// the empty list.
+func (o *NodeOptions) SetTransports(enabled string, published string) error {
+	for _, list := range []struct {
+		value string
+		set   func(t *TransportOptions, on *bool)
+	}{
+		{enabled, func(t *TransportOptions, on *bool) { t.Enabled = on }},
+		{published, func(t *TransportOptions, on *bool) { t.Published = on }},
+	} {
+		if list.value == "" {
+			continue
+		}
+		listed, err := parseTransportList(list.value)
+		if err != nil {
+			return err
+		}
+		for _, transport := range []struct {
+			name    string
+			options **TransportOptions
+		}{{TRANSPORT_NTCP2, &o.NTCP2}, {TRANSPORT_SSU2, &o.SSU2}} {
+			if *transport.options == nil {
+				*transport.options = &TransportOptions{}
+			}
+			on := listed[transport.name]
+			list.set(*transport.options, &on)
+		}
+	}
+	return o.ValidateTransports()
+}
+
+// ValidateTransports checks that the router keeps at least one transport and publishes only enabled ones
+func (o NodeOptions) ValidateTransports() error {
+	if err := o.NTCP2.validate(TRANSPORT_NTCP2); err != nil {
+		return err
+	}
+	if err := o.SSU2.validate(TRANSPORT_SSU2); err != nil {
+		return err
+	}
+	if !o.NTCP2.IsEnabled() && !o.SSU2.IsEnabled() {
+		return fmt.Errorf("a router needs at least one of the transports %s and %s", TRANSPORT_NTCP2, TRANSPORT_SSU2)
+	}
+	return nil
+}
+
+// CheckTransports returns an error if a router of the kind can't run with the transports the options choose.
+// Disabling or not publishing a transport needs a kind that implements nodekind.TransportSelector for it, go-i2p
+// for one has no transport settings.
+func (o NodeOptions) CheckTransports(k nodekind.NodeKind) error {
+	if err := o.ValidateTransports(); err != nil {
+		return err
+	}
+	var selectable []string
+	if selector, ok := k.(nodekind.TransportSelector); ok {
+		selectable = selector.Transports()
+	}
+	for _, transport := range []struct {
+		name    string
+		options *TransportOptions
+	}{{TRANSPORT_NTCP2, o.NTCP2}, {TRANSPORT_SSU2, o.SSU2}} {
+		if transport.options.IsPublished() || slices.Contains(selectable, transport.name) {
+			continue
+		}
+		return fmt.Errorf("router kind %s always enables and publishes %s", k.Name(), transport.name)
+	}
+	return nil
+}
+
+// ValidateAddressFamily checks that family is empty or one of the known address families
+func ValidateAddressFamily(family string) error {
+	switch family {
+	case "", FAMILY_IPV4, FAMILY_IPV6, FAMILY_DUAL:
+		return nil
+	}
+	return fmt.Errorf("unknown address family %q, use %s, %s or %s", family, FAMILY_IPV4, FAMILY_IPV6, FAMILY_DUAL)
+}
+
+// ValidateNAT checks that nat is empty or one of the known kinds of NAT
+func ValidateNAT(nat string) error {
+	switch nat {
+	case "", NAT_FULL_CONE, NAT_SYMMETRIC:
+		return nil
+	}
+	return fmt.Errorf("unknown NAT %q, use %s or %s", nat, NAT_FULL_CONE, NAT_SYMMETRIC)
+}
+
+// validate checks the options that can be wrong on their own
+func (o NodeOptions) validate() error {
+	if err := o.Netem.Validate(); err != nil {
+		return err
+	}
+	if err := ValidateAddressFamily(o.AddressFamily); err != nil {
+		return err
+	}
+	if err := ValidateNAT(o.NAT); err != nil {
+		return err
+	}
+	if o.NAT != "" && o.AddressFamily != "" && o.AddressFamily != FAMILY_IPV4 {
+		return fmt.Errorf("routers behind a NAT only use IPv4, not address family %s", o.AddressFamily)
+	}
+	return o.ValidateTransports()
+}
+
+// IsFloodfill reports whether the options ask for a floodfill router
+func (o NodeOptions) IsFloodfill() bool {
+	return o.Floodfill != nil && *o.Floodfill
+}
+
+// IsPublished reports whether the options ask for the router's services to be published on host ports
+func (o NodeOptions) IsPublished() bool {
+	return o.Publish != nil && *o.Publish
+}
+
+// merge returns o with every option that is set in override replaced
+func (o NodeOptions) merge(override NodeOptions) NodeOptions {
+	if override.Floodfill != nil {
+		o.Floodfill = override.Floodfill
+	}
+	if override.Version != "" {
+		o.Version = override.Version
+	}
+	if override.Netem != nil {
+		o.Netem = override.Netem
+	}
+	if override.AddressFamily != "" {
+		o.AddressFamily = override.AddressFamily
+	}
+	if override.NAT != "" {
+		o.NAT = override.NAT
+	}
+	if override.Publish != nil {
+		o.Publish = override.Publish
+	}
+	o.NTCP2 = o.NTCP2.merge(override.NTCP2)
+	o.SSU2 = o.SSU2.merge(override.SSU2)
+	return o
+}
+
+// Options returns the effective options of the router at the 1-based index within the group
+func (g RouterGroup) Options(index int) NodeOptions {
+	opts := g.NodeOptions
+	if override, ok := g.Overrides[index]; ok {
+		opts = opts.merge(override)
+	}
+	return opts
+}
+
+// NormalizeKind maps the accepted spellings of a router kind (e.g. "i2pd_router", "go-i2p") to its canonical name
+func NormalizeKind(kind string) string {
+	return nodekind.Normalize(kind)
+}
+
+// Validate checks that every group names a known kind and sane counts
+func (t *Topology) Validate() error {
+	for i, group := range t.Routers {
+		k, ok := nodekind.Lookup(group.Kind)
+		if !ok {
+			return fmt.Errorf("router group %d: unknown kind %q, available kinds: %s", i+1, group.Kind, strings.Join(nodekind.Names(), ", "))
+		}
+		if group.Count < 0 {
+			return fmt.Errorf("router group %d: count must not be negative", i+1)
+		}
+		if err := group.NodeOptions.validate(); err != nil {
+			return fmt.Errorf("router group %d: %v", i+1, err)
+		}
+		if err := group.NodeOptions.CheckTransports(k); err != nil {
+			return fmt.Errorf("router group %d: %v", i+1, err)
+		}
+		for index := range group.Overrides {
+			if index < 1 || index > group.Count {
+				return fmt.Errorf("router group %d: override for node %d is out of range 1-%d", i+1, index, group.Count)
+			}
+			// An override may only be invalid together with the group's options, e.g. disabling its other transport
+			if err := group.Options(index).validate(); err != nil {
+				return fmt.Errorf("router group %d, node %d: %v", i+1, index, err)
+			}
+			if err := group.Options(index).CheckTransports(k); err != nil {
+				return fmt.Errorf("router group %d, node %d: %v", i+1, index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Append adds a single router to the topology, growing the last group when it has the same kind and options
+func (t *Topology) Append(kind string, opts NodeOptions) {
+	if n := len(t.Routers); n > 0 {
+		last := &t.Routers[n-1]
+		if last.Kind == kind && len(last.Overrides) == 0 && reflect.DeepEqual(last.NodeOptions, opts) {
+			last.Count++
+			return
+		}
+	}
+	t.Routers = append(t.Routers, RouterGroup{Kind: kind, Count: 1, NodeOptions: opts})
+}
+
+// Load reads a topology from a YAML or JSON file, chosen by the file extension
+func Load(path string) (*Topology, error) {
+	log.WithField("path", path).Debug("Loading topology file")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading topology file: %v", err)
+	}
+
+	t := &Topology{}
+	if isJSON(path) {
+		err = json.Unmarshal(data, t)
+	} else {
+		err = yaml.Unmarshal(data, t)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing topology file %s: %v", path, err)
+	}
+
+	for i := range t.Routers {
+		t.Routers[i].Kind = NormalizeKind(t.Routers[i].Kind)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"path":   path,
+		"groups": len(t.Routers),
+	}).Debug("Successfully loaded topology file")
+	return t, nil
+}
+
+// Save writes the topology to a YAML or JSON file, chosen by the file extension
+func Save(path string, t *Topology) error {
+	log.WithField("path", path).Debug("Saving topology file")
+	var (
+		data []byte
+		err  error
+	)
+	if isJSON(path) {
+		data, err = json.MarshalIndent(t, "", "  ")
+	} else {
+		data, err = yaml.Marshal(t)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding topology: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing topology file: %v", err)
+	}
+	return nil
+}
+
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
@@ -0,0 +1,271 @@
+package topology_test
+
+import (
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/topology"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "go-i2p-testnet/lib/go-i2p"
+	_ "go-i2p-testnet/lib/i2pd"
+	_ "go-i2p-testnet/lib/i2pjava"
+)
+
+// load writes content to a file called name in a temporary directory and loads it
+func load(t *testing.T, name string, content string) (*topology.Topology, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return topology.Load(path)
+}
+
+func TestLoad(t *testing.T) {
+	yamlTopology := `
+routers:
+  - kind: go-i2p
+    count: 2
+    floodfill: true
+  - kind: i2pd_router
+    count: 3
+    version: 2.54.0
+    netem:
+      delay: 120ms
+    overrides:
+      2:
+        nat: symmetric
+        ssu2:
+          published: false
+`
+	jsonTopology := `{"routers": [
+  {"kind": "go-i2p", "count": 2, "floodfill": true},
+  {"kind": "i2pd_router", "count": 3, "version": "2.54.0", "netem": {"delay": "120ms"},
+   "overrides": {"2": {"nat": "symmetric", "ssu2": {"published": false}}}}
+]}`
+
+	for name, content := range map[string]string{"topology.yaml": yamlTopology, "topology.JSON": jsonTopology} {
+		t.Run(name, func(t *testing.T) {
+			top, err := load(t, name, content)
+			if err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			if len(top.Routers) != 2 {
+				t.Fatalf("Load() has %d groups, want 2", len(top.Routers))
+			}
+			goi2p, i2pd := top.Routers[0], top.Routers[1]
+			if goi2p.Kind != topology.KindGoI2P || goi2p.Count != 2 || !goi2p.IsFloodfill() {
+				t.Errorf("first group = %+v, want 2 floodfill %s routers", goi2p, topology.KindGoI2P)
+			}
+			if i2pd.Kind != topology.KindI2PD || i2pd.Count != 3 {
+				t.Errorf("second group = %+v, want 3 %s routers", i2pd, topology.KindI2PD)
+			}
+
+			// Node 2 keeps the group's version and netem and adds its own NAT and transports
+			node2 := i2pd.Options(2)
+			if node2.Version != "2.54.0" || node2.Netem.Delay != "120ms" || node2.NAT != topology.NAT_SYMMETRIC {
+				t.Errorf("Options(2) = %+v, want the group's version and netem behind a symmetric NAT", node2)
+			}
+			if !node2.SSU2.IsEnabled() || node2.SSU2.IsPublished() || !node2.NTCP2.IsPublished() {
+				t.Errorf("Options(2) transports = %+v, %+v, want SSU2 enabled but unpublished", node2.NTCP2, node2.SSU2)
+			}
+			for _, index := range []int{1, 3} {
+				if opts := i2pd.Options(index); !reflect.DeepEqual(opts, i2pd.NodeOptions) {
+					t.Errorf("Options(%d) = %+v, want the group's options", index, opts)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		topology string
+		err      string
+	}{
+		{"unknown kind", "routers:\n  - kind: bogus\n    count: 1\n", `unknown kind "bogus"`},
+		{"negative count", "routers:\n  - kind: i2pd\n    count: -1\n", "count must not be negative"},
+		{"override out of range", "routers:\n  - kind: i2pd\n    count: 2\n    overrides:\n      3:\n        floodfill: true\n", "out of range 1-2"},
+		{"override at 0", "routers:\n  - kind: i2pd\n    count: 2\n    overrides:\n      0:\n        floodfill: true\n", "out of range 1-2"},
+		{"bad netem", "routers:\n  - kind: i2pd\n    count: 1\n    netem:\n      jitter: 20ms\n", "needs a delay"},
+		{"bad override netem", "routers:\n  - kind: i2pd\n    count: 1\n    overrides:\n      1:\n        netem:\n          loss: 200%\n", "node 1: invalid netem loss"},
+		{"unknown family", "routers:\n  - kind: i2pd\n    count: 1\n    address_family: ipv5\n", "unknown address family"},
+		{"unknown NAT", "routers:\n  - kind: i2pd\n    count: 1\n    nat: cone\n", "unknown NAT"},
+		{"IPv6 behind a NAT", "routers:\n  - kind: i2pd\n    count: 1\n    nat: full-cone\n    overrides:\n      1:\n        address_family: ipv6\n", "node 1: routers behind a NAT only use IPv4"},
+		{
+			name:     "override disables the group's other transport",
+			topology: "routers:\n  - kind: i2pd\n    count: 2\n    ntcp2:\n      enabled: false\n    overrides:\n      2:\n        ssu2:\n          enabled: false\n",
+			err:      "node 2: a router needs at least one",
+		},
+		{"published but disabled", "routers:\n  - kind: java\n    count: 1\n    ssu2:\n      enabled: false\n      published: true\n", "can't be published when it is disabled"},
+		{"go-i2p without NTCP2", "routers:\n  - kind: goi2p\n    count: 1\n    ntcp2:\n      enabled: false\n", "router kind goi2p always enables and publishes ntcp2"},
+		{"go-i2p override", "routers:\n  - kind: goi2p\n    count: 2\n    overrides:\n      2:\n        ssu2:\n          published: false\n", "node 2: router kind goi2p always enables and publishes ssu2"},
+		{"malformed", "routers: [", "error parsing topology file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(t, "topology.yaml", tt.topology)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Load() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	yes, no := true, false
+	want := &topology.Topology{Routers: []topology.RouterGroup{
+		{Kind: topology.KindGoI2P, Count: 1, NodeOptions: topology.NodeOptions{Floodfill: &yes, Version: "main"}},
+		{
+			Kind:  topology.KindJava,
+			Count: 2,
+			NodeOptions: topology.NodeOptions{
+				Netem:         &topology.Netem{Delay: "80ms", Loss: "1%"},
+				AddressFamily: topology.FAMILY_DUAL,
+				Publish:       &yes,
+				NTCP2:         &topology.TransportOptions{Published: &no},
+			},
+			Overrides: map[int]topology.NodeOptions{2: {NAT: topology.NAT_FULL_CONE, AddressFamily: topology.FAMILY_IPV4}},
+		},
+	}}
+	for _, name := range []string{"topology.yml", "topology.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := topology.Save(path, want); err != nil {
+				t.Fatalf("Save() = %v", err)
+			}
+			got, err := topology.Load(path)
+			if err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load(Save()) = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestAppend(t *testing.T) {
+	yes := true
+	floodfill := topology.NodeOptions{Floodfill: &yes}
+	top := &topology.Topology{}
+	top.Append(topology.KindI2PD, topology.NodeOptions{})
+	top.Append(topology.KindI2PD, topology.NodeOptions{})
+	top.Append(topology.KindI2PD, floodfill)
+	top.Append(topology.KindI2PD, topology.NodeOptions{Floodfill: &yes})
+	top.Append(topology.KindJava, topology.NodeOptions{})
+	top.Append(topology.KindI2PD, topology.NodeOptions{})
+
+	want := []struct {
+		kind      string
+		count     int
+		floodfill bool
+	}{
+		{topology.KindI2PD, 2, false},
+		{topology.KindI2PD, 2, true},
+		{topology.KindJava, 1, false},
+		{topology.KindI2PD, 1, false},
+	}
+	if len(top.Routers) != len(want) {
+		t.Fatalf("Append() made %d groups, want %d", len(top.Routers), len(want))
+	}
+	for i, w := range want {
+		g := top.Routers[i]
+		if g.Kind != w.kind || g.Count != w.count || g.IsFloodfill() != w.floodfill {
+			t.Errorf("group %d = %s x%d floodfill %v, want %s x%d floodfill %v", i+1, g.Kind, g.Count, g.IsFloodfill(), w.kind, w.count, w.floodfill)
+		}
+	}
+
+	// A group with overrides is never grown, its last router may differ
+	top.Routers[3].Overrides = map[int]topology.NodeOptions{1: floodfill}
+	top.Append(topology.KindI2PD, topology.NodeOptions{})
+	if len(top.Routers) != 5 {
+		t.Errorf("Append() grew a group with overrides")
+	}
+}
+
+func TestSetTransports(t *testing.T) {
+	tests := []struct {
+		enabled   string
+		published string
+		// want is whether NTCP2 and SSU2 are enabled and published, in that order
+		want [4]bool
+		err  string
+	}{
+		{"", "", [4]bool{true, true, true, true}, ""},
+		{"ntcp2,ssu2", "", [4]bool{true, true, true, true}, ""},
+		{"ssu2", "", [4]bool{false, false, true, true}, ""},
+		{" NTCP2 ", "", [4]bool{true, true, false, false}, ""},
+		{"", "ssu2", [4]bool{true, false, true, true}, ""},
+		{"", "none", [4]bool{true, false, true, false}, ""},
+		{"ntcp2,ssu2", "ntcp2", [4]bool{true, true, true, false}, ""},
+		{"none", "", [4]bool{}, "at least one"},
+		{"ssu2", "ntcp2", [4]bool{}, "ntcp2 can't be published when it is disabled"},
+		{"ntcp2,tcp", "", [4]bool{}, `unknown transport "tcp"`},
+		{"", "ssu", [4]bool{}, `unknown transport "ssu"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.enabled+"/"+tt.published, func(t *testing.T) {
+			var opts topology.NodeOptions
+			err := opts.SetTransports(tt.enabled, tt.published)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("SetTransports() = %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetTransports() = %v", err)
+			}
+			got := [4]bool{opts.NTCP2.IsEnabled(), opts.NTCP2.IsPublished(), opts.SSU2.IsEnabled(), opts.SSU2.IsPublished()}
+			if got != tt.want {
+				t.Errorf("SetTransports() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTransports(t *testing.T) {
+	var ssu2Only topology.NodeOptions
+	if err := ssu2Only.SetTransports("ssu2", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		kind string
+		opts topology.NodeOptions
+		ok   bool
+	}{
+		{topology.KindGoI2P, topology.NodeOptions{}, true},
+		{topology.KindGoI2P, ssu2Only, false},
+		{topology.KindI2PD, ssu2Only, true},
+		{topology.KindJava, ssu2Only, true},
+	} {
+		k, ok := nodekind.Lookup(tt.kind)
+		if !ok {
+			t.Fatalf("kind %s isn't registered", tt.kind)
+		}
+		if err := tt.opts.CheckTransports(k); (err == nil) != tt.ok {
+			t.Errorf("CheckTransports(%s) = %v, want ok %v", tt.kind, err, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeKind(t *testing.T) {
+	for kind, want := range map[string]string{
+		"goi2p":        topology.KindGoI2P,
+		"Go-I2P":       topology.KindGoI2P,
+		" go_i2p ":     topology.KindGoI2P,
+		"i2pd_router":  topology.KindI2PD,
+		"i2p-java":     topology.KindJava,
+		"JAVA_router":  topology.KindJava,
+		"custom-thing": "custom-thing",
+	} {
+		if got := topology.NormalizeKind(kind); got != want {
+			t.Errorf("NormalizeKind(%q) = %q, want %q", kind, got, want)
+		}
+	}
+}
@@ -3,188 +3,212 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/chzyer/readline"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/go-i2p/go-i2p/lib/common/base64"
 	"github.com/go-i2p/go-i2p/lib/common/router_info"
 	"go-i2p-testnet/lib/docker_control"
-	goi2pnode "go-i2p-testnet/lib/go-i2p"
-	"go-i2p-testnet/lib/i2pd"
+	"go-i2p-testnet/lib/nodekind"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/testnet"
+	"go-i2p-testnet/lib/topology"
 	"go-i2p-testnet/lib/utils/logger"
 	"os"
 	"os/signal"
 	"strings"
-	"sync"
 	"syscall"
 )
 
 var (
-	running = false
-	// Track created containers and volumes for cleanup
-	createdRouters    []string
-	createdContainers []string
-	createdVolumes    []string
-	sharedVolumeName  string
-	mu                sync.Mutex // To protect access to the slices
-	log               = logger.GetTestnetLogger()
+	// tn is the testnet managed by this process, nil until one is started or attached
+	tn          *testnet.Testnet
+	testnetName = docker_control.DEFAULT_TESTNET
+	log         = logger.GetTestnetLogger()
 )
 
-var completer = readline.NewPrefixCompleter(
-	readline.PcItem("help"),
-	readline.PcItem("start"),
-	readline.PcItem("stop"),
-	readline.PcItem("status"),
-	readline.PcItem("usage"),
-	readline.PcItem("build"),
-	readline.PcItem("rebuild"),
-	readline.PcItem("remove_images"),
-	readline.PcItem("add",
-		readline.PcItem("goi2p_router"),
-		readline.PcItem("i2pd_router"),
-	),
-	readline.PcItem("sync_i2pd_shared"),
-	readline.PcItem("sync_i2pd_netdb"),
-	readline.PcItem("exit"),
-)
-
-const (
-	NETWORK = "go-i2p-testnet"
-)
-
-// cleanup removes all created Docker resources: containers, volumes, and network.
-func cleanup(cli *client.Client, ctx context.Context, createdContainers []string, createdVolumes []string, networkName string) {
-	log.WithField("networkName", networkName).Debug("Starting cleanup of Docker resources")
+// running reports whether this process manages a running testnet
+func running() bool {
+	return tn != nil && tn.Running()
+}
 
-	// Remove containers
-	for _, containerID := range createdContainers {
-		log.WithField("containerID", containerID).Debug("Attempting to stop container")
-		// Attempt to stop the container
-		timeout := 10 // seconds
-		err := cli.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout})
-		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"containerID": containerID,
-				"error":       err,
-			}).Error("Failed to stop container")
+// newCompleter builds the tab completion, offering every registered router kind
+func newCompleter() *readline.PrefixCompleter {
+	var buildKinds, addKinds []readline.PrefixCompleterInterface
+	for _, k := range nodekind.All() {
+		buildFlags := []readline.PrefixCompleterInterface{readline.PcItem("--version")}
+		if _, ok := k.(nodekind.SourceBuilder); ok {
+			buildFlags = append(buildFlags, readline.PcItem("--src"))
 		}
+		buildKinds = append(buildKinds, readline.PcItem(k.Name(), buildFlags...))
+		addKinds = append(addKinds, readline.PcItem(k.Name()+"_router",
+			readline.PcItem("--version"),
+			readline.PcItem("--behind-nat",
+				readline.PcItem(topology.NAT_FULL_CONE),
+				readline.PcItem(topology.NAT_SYMMETRIC),
+			),
+			readline.PcItem("--publish"),
+			readline.PcItem("--transports",
+				readline.PcItem(topology.TRANSPORT_NTCP2),
+				readline.PcItem(topology.TRANSPORT_SSU2),
+			),
+			readline.PcItem("--published-transports",
+				readline.PcItem(topology.TRANSPORT_NTCP2),
+				readline.PcItem(topology.TRANSPORT_SSU2),
+				readline.PcItem("none"),
+			),
+		))
+	}
 
-		// Attempt to remove the container
-		log.WithField("containerID", containerID).Debug("Attempting to remove container")
-		removeOptions := container.RemoveOptions{Force: true}
-		err = cli.ContainerRemove(ctx, containerID, removeOptions)
-		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"containerID": containerID,
-				"error":       err,
-			}).Error("Failed to remove container")
-		} else {
-			log.WithField("containerID", containerID).Debug("Successfully removed container")
+	return readline.NewPrefixCompleter(
+		readline.PcItem("help"),
+		readline.PcItem("start",
+			readline.PcItem("--topology"),
+			readline.PcItem("--name"),
+			readline.PcItem("--subnet"),
+			readline.PcItem("--ipv6"),
+			readline.PcItem("--subnet6"),
+		),
+		readline.PcItem("stop"),
+		readline.PcItem("attach"),
+		readline.PcItem("list"),
+		readline.PcItem("status",
+			readline.PcItem("--json"),
+		),
+		readline.PcItem("usage"),
+		readline.PcItem("build", buildKinds...),
+		readline.PcItem("rebuild"),
+		readline.PcItem("remove_images"),
+		readline.PcItem("images",
+			readline.PcItem("list"),
+			readline.PcItem("export"),
+			readline.PcItem("import"),
+		),
+		readline.PcItem("add", addKinds...),
+		readline.PcItem("remove"),
+		readline.PcItem("restart"),
+		readline.PcItem("stop-node"),
+		readline.PcItem("start-node"),
+		readline.PcItem("pause"),
+		readline.PcItem("unpause"),
+		readline.PcItem("wait-ready",
+			readline.PcItem("all"),
+			readline.PcItem("--timeout"),
+			readline.PcItem("--tunnels"),
+		),
+		readline.PcItem("logs",
+			readline.PcItem("--tail"),
+			readline.PcItem("--level"),
+		),
+		readline.PcItem("netem"),
+		readline.PcItem("partition"),
+		readline.PcItem("heal"),
+		readline.PcItem("ports",
+			readline.PcItem("--json"),
+		),
+		readline.PcItem("save_topology"),
+		readline.PcItem("sync"),
+		readline.PcItem("sync_shared"),
+		readline.PcItem("sync_netdb"),
+		readline.PcItem("prune",
+			readline.PcItem("--dry-run"),
+			readline.PcItem("--all"),
+		),
+		readline.PcItem("exit"),
+	)
+}
+
+// start creates a new testnet with the selected name, on subnet unless it is empty. With ipv6 the network is
+// dual-stack, on subnet6 unless it is empty.
+func start(cli *client.Client, ctx context.Context, subnet string, ipv6 bool, subnet6 string) error {
+	t, err := testnet.New(cli, testnetName)
+	if err != nil {
+		return err
+	}
+	if subnet != "" {
+		if err := t.SetSubnet(subnet); err != nil {
+			return err
 		}
 	}
-
-	// Remove volumes
-	for _, volumeName := range createdVolumes {
-		log.WithField("volumeName", volumeName).Debug("Attempting to remove volume")
-		err := cli.VolumeRemove(ctx, volumeName, true)
-		if err != nil {
-			log.WithFields(map[string]interface{}{
-				"volumeName": volumeName,
-				"error":      err,
-			}).Error("Failed to remove volume")
-		} else {
-			log.WithField("volumeName", volumeName).Debug("Successfully removed volume")
+	if ipv6 {
+		if err := t.SetIPv6(subnet6); err != nil {
+			return err
 		}
 	}
-
-	// Remove network
-	log.WithField("networkName", networkName).Debug("Attempting to remove network")
-	err := cli.NetworkRemove(ctx, networkName)
-	if err != nil {
-		log.WithFields(map[string]interface{}{
-			"networkName": networkName,
-			"error":       err,
-		}).Error("Failed to remove network")
-	} else {
-		log.WithField("networkName", networkName).Debug("Successfully removed network")
+	if err := t.Start(ctx); err != nil {
+		return err
 	}
+	tn = t
+	persistState()
+	return nil
 }
 
-func addCreated(containerID, volumeID string) {
-	//mu.Lock() //For some reason, this freezes
-	//defer mu.Unlock()
-	log.WithFields(map[string]interface{}{
-		"containerID": containerID,
-		"volumeID":    volumeID,
-	}).Debug("Tracking new container and volume")
-	createdContainers = append(createdContainers, containerID)
-	createdVolumes = append(createdVolumes, volumeID)
-	return
-}
-
-func start(cli *client.Client, ctx context.Context) {
-	log.Debug("Starting testnet initialization")
-	// Create Docker network
-	networkName := NETWORK
-	log.WithField("networkName", networkName).Debug("Creating Docker network")
-	networkID, err := docker_control.CreateDockerNetwork(cli, ctx, networkName)
-	if err != nil {
-		log.WithError(err).Fatal("Failed to create Docker network")
-	}
-	log.WithFields(map[string]interface{}{
-		"networkName": networkName,
-		"networkID":   networkID,
-	}).Debug("Successfully created network")
-
-	//Create shared volume
-	log.Debug("Creating shared volume")
-	sharedVolumeName, err = docker_control.CreateSharedVolume(cli, ctx)
-	if err != nil {
-		log.Fatalf("error creating shared volume: %v", err)
+// shutdown removes every testnet resource and forgets the saved state
+func shutdown(ctx context.Context) {
+	if err := tn.Stop(ctx); err != nil {
+		fmt.Printf("Warning: cleanup was incomplete: %v\n", err)
 	}
-	createdVolumes = append(createdVolumes, sharedVolumeName)
-	running = true
-	log.WithField("volumeName", sharedVolumeName).Debug("Successfully created shared volume")
+	tn = nil
+	persistState()
 }
 
-func status(cli *client.Client, ctx context.Context) {
-	log.Debug("Fetching status of router containers")
-
-	// List all containers (both running and stopped)
-	containerListOptions := container.ListOptions{
-		All: true,
+func status(ctx context.Context, asJSON bool) error {
+	var routers []testnet.RouterStatus
+	if tn != nil {
+		var err error
+		routers, err = tn.Status(ctx)
+		if err != nil {
+			return err
+		}
 	}
-	containers, err := cli.ContainerList(ctx, containerListOptions)
-	if err != nil {
-		log.WithError(err).Error("Failed to list Docker containers")
-		fmt.Println("Error: failed to list Docker containers:", err)
-		return
+
+	if asJSON {
+		out := map[string]interface{}{
+			"running": running(),
+			"name":    testnetName,
+			"network": testnetName,
+			"subnet":  "",
+			"routers": routers,
+		}
+		if tn != nil {
+			out["network"] = tn.NetworkName()
+			out["subnet"] = tn.Subnet()
+			out["subnet6"] = tn.Subnet6()
+			out["partition"] = tn.Partition()
+		}
+		return printJSON(out)
 	}
 
-	// Filter containers whose names start with "router"
 	fmt.Println("Current router containers:")
-	found := false
-	for _, _container := range containers {
-		for _, name := range _container.Names {
-			// Docker prepends "/" to _container names
-			if strings.HasPrefix(name, "/router") {
-				found = true
-				fmt.Printf("Container ID: %s, Name: %s, Image: %s, Status: %s\n",
-					_container.ID[:12], name[1:], _container.Image, _container.Status)
-			}
+	for _, r := range routers {
+		ready := "yes"
+		if !r.Ready {
+			ready = "no (" + r.NotReady + ")"
+		}
+		nat := ""
+		if r.NAT != "" {
+			nat = ", Behind NAT: " + r.NAT
 		}
+		fmt.Printf("Container ID: %s, Name: %s, Image: %s, Version: %s, Status: %s, Ready: %s%s\n",
+			r.ContainerID, r.Name, r.Image, r.Version, r.Status, ready, nat)
 	}
-	if !found {
+	if len(routers) == 0 {
 		fmt.Println("No router containers are running.")
 	}
+	if tn != nil && tn.Partitioned() {
+		printPartition(tn.Partition())
+	}
+	return nil
 }
+
 func usage(cli *client.Client, ctx context.Context) {
 	log.Debug("Fetching usage statistics for router containers")
 
-	// List all containers
-	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	// List the router containers of this testnet
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: docker_control.RouterFilter(tn.ID())})
 	if err != nil {
 		log.WithError(err).Error("Failed to list Docker containers")
 		fmt.Println("Error: failed to list Docker containers:", err)
@@ -197,173 +221,67 @@ func usage(cli *client.Client, ctx context.Context) {
 	fmt.Println(strings.Repeat("-", 75))
 
 	for _, c := range containers {
-		// Filter for router containers
-		for _, name := range c.Names {
-			if strings.HasPrefix(name, "/router") {
-				found = true
-
-				// Get container stats
-				stats, err := cli.ContainerStats(ctx, c.ID, false)
-				if err != nil {
-					log.WithFields(map[string]interface{}{
-						"containerID": c.ID,
-						"error":       err,
-					}).Error("Failed to get container stats")
-					continue
-				}
-
-				// Decode stats
-				var v *container.StatsResponse
-				decoder := json.NewDecoder(stats.Body)
-				err = decoder.Decode(&v)
-				stats.Body.Close()
-
-				if err != nil {
-					log.WithError(err).Error("Failed to decode container stats")
-					continue
-				}
-
-				// Calculate memory usage in MB
-				memUsageMB := float64(v.MemoryStats.Usage) / 1024 / 1024 // Convert to MB
-				memLimitMB := float64(v.MemoryStats.Limit) / 1024 / 1024 // Convert to MB
-
-				// Calculate CPU percentage
-				cpuDelta := float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PreCPUStats.CPUUsage.TotalUsage)
-				systemDelta := float64(v.CPUStats.SystemUsage) - float64(v.PreCPUStats.SystemUsage)
-				cpuPercent := 0.0
-				if systemDelta > 0 && cpuDelta > 0 {
-					cpuPercent = (cpuDelta / systemDelta) * float64(len(v.CPUStats.CPUUsage.PercpuUsage)) * 100
-				}
-
-				fmt.Printf("%-20s %-20.2f %-20.2f %-10.2f\n",
-					strings.TrimPrefix(name, "/"),
-					memUsageMB,
-					memLimitMB,
-					cpuPercent)
-			}
-		}
-	}
-
-	if !found {
-		fmt.Println("No router containers found.")
-	}
-}
-func addGOI2PRouter(cli *client.Client, ctx context.Context) error {
-	mu.Lock()
-	defer mu.Unlock()
-	routerID := len(createdRouters) + 1
-
-	log.WithField("routerID", routerID).Debug("Adding new go-i2p router")
-
-	// Calculate next IP
-	incr := routerID + 1
-	if incr == 256 {
-		log.Error("Maximum number of nodes reached (255)")
-		return fmt.Errorf("too many nodes! (255)")
-	}
-	nextIP := fmt.Sprintf("172.28.0.%d", incr)
-
-	log.WithFields(map[string]interface{}{
-		"routerID": routerID,
-		"ip":       nextIP,
-	}).Debug("Generating router configuration")
-
-	configData := goi2pnode.GenerateRouterConfig(routerID)
+		found = true
+		name := testnet.ContainerName(c)
 
-	// Create the container
-	log.Debug("Creating router container")
-	containerID, volumeID, err := goi2pnode.CreateRouterContainer(cli, ctx, routerID, nextIP, NETWORK, configData)
-	if err != nil {
-		log.WithError(err).Error("Failed to create router container")
-		return err
-	}
-
-	log.WithFields(map[string]interface{}{
-		"routerID":    routerID,
-		"containerID": containerID,
-		"volumeID":    volumeID,
-		"ip":          nextIP,
-	}).Debug("Adding router to tracking lists")
-	createdRouters = append(createdRouters, containerID)
-	createdContainers = append(createdContainers, containerID)
-	createdVolumes = append(createdVolumes, volumeID)
-
-	addCreated(containerID, volumeID)
-	return nil
-}
+		// Get container stats
+		stats, err := cli.ContainerStats(ctx, c.ID, false)
+		if err != nil {
+			log.WithFields(map[string]interface{}{
+				"containerID": c.ID,
+				"error":       err,
+			}).Error("Failed to get container stats")
+			continue
+		}
 
-func addI2PDRouter(cli *client.Client, ctx context.Context) error {
-	mu.Lock()
-	defer mu.Unlock()
-	routerID := len(createdRouters) + 1
+		// Decode stats
+		var v *container.StatsResponse
+		decoder := json.NewDecoder(stats.Body)
+		err = decoder.Decode(&v)
+		stats.Body.Close()
 
-	log.WithField("routerID", routerID).Debug("Adding new i2pd router")
+		if err != nil {
+			log.WithError(err).Error("Failed to decode container stats")
+			continue
+		}
 
-	// Calculate next IP
-	incr := routerID + 1
-	if incr == 256 {
-		log.Error("Maximum number of nodes reached (255)")
-		return fmt.Errorf("too many nodes! (255)")
-	}
-	nextIP := fmt.Sprintf("172.28.0.%d", incr)
+		// Calculate memory usage in MB
+		memUsageMB := float64(v.MemoryStats.Usage) / 1024 / 1024 // Convert to MB
+		memLimitMB := float64(v.MemoryStats.Limit) / 1024 / 1024 // Convert to MB
 
-	log.WithFields(map[string]interface{}{
-		"routerID": routerID,
-		"ip":       nextIP,
-	}).Debug("Generating router configuration")
+		// Calculate CPU percentage
+		cpuDelta := float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PreCPUStats.CPUUsage.TotalUsage)
+		systemDelta := float64(v.CPUStats.SystemUsage) - float64(v.PreCPUStats.SystemUsage)
+		cpuPercent := 0.0
+		if systemDelta > 0 && cpuDelta > 0 {
+			cpuPercent = (cpuDelta / systemDelta) * float64(len(v.CPUStats.CPUUsage.PercpuUsage)) * 100
+		}
 
-	// Generate the configuration data
-	configData, err := i2pd.GenerateRouterConfig(routerID)
-	if err != nil {
-		log.WithError(err).Error("Failed to generate i2pd router config")
-		return err
+		fmt.Printf("%-20s %-20.2f %-20.2f %-10.2f\n",
+			name,
+			memUsageMB,
+			memLimitMB,
+			cpuPercent)
 	}
 
-	// Create configuration volume
-	volumeName := fmt.Sprintf("i2pd_router%d_config", routerID)
-	createOptions := volume.CreateOptions{
-		Name: volumeName,
-	}
-	_, err = cli.VolumeCreate(ctx, createOptions)
-	if err != nil {
-		log.WithFields(map[string]interface{}{
-			"volumeName": volumeName,
-			"error":      err,
-		}).Error("Failed to create volume")
-		return err
+	if !found {
+		fmt.Println("No router containers found.")
 	}
+}
 
-	// Copy configuration to volume
-	err = i2pd.CopyConfigToVolume(cli, ctx, volumeName, configData)
-	if err != nil {
-		log.WithFields(map[string]interface{}{
-			"volumeName": volumeName,
-			"error":      err,
-		}).Error("Failed to copy config to volume")
-		return err
+// applyTopology creates every router described by the topology on the running testnet
+func applyTopology(ctx context.Context, t *topology.Topology, parallel int) error {
+	log.WithField("groups", len(t.Routers)).Debug("Applying topology")
+	var specs []testnet.RouterSpec
+	for _, group := range t.Routers {
+		for i := 1; i <= group.Count; i++ {
+			specs = append(specs, testnet.RouterSpec{Kind: group.Kind, Options: group.Options(i)})
+		}
 	}
-
-	// Create and start router container
-	containerID, err := i2pd.CreateRouterContainer(cli, ctx, routerID, nextIP, NETWORK, volumeName)
-	if err != nil {
-		log.WithError(err).Error("Failed to create i2pd router container")
+	if err := createRouters(ctx, specs, parallel); err != nil {
 		return err
 	}
-
-	log.WithFields(map[string]interface{}{
-		"routerID":    routerID,
-		"containerID": containerID,
-		"volumeID":    volumeName,
-		"ip":          nextIP,
-	}).Debug("Adding router to tracking lists")
-
-	// Update tracking lists
-	createdRouters = append(createdRouters, containerID)
-	createdContainers = append(createdContainers, containerID)
-	createdVolumes = append(createdVolumes, volumeName)
-
-	// Add to any additional tracking structures if necessary
-	addCreated(containerID, volumeName)
+	log.Debug("Successfully applied topology")
 	return nil
 }
 
@@ -377,11 +295,34 @@ func main() {
 		log.WithError(err).Fatal("Failed to create Docker client")
 	}
 
+	// Global flags select the testnet, so several can run side by side on one Docker host
+	name := os.Getenv(TESTNET_NAME_ENV)
+	if name == "" {
+		name = docker_control.DEFAULT_TESTNET
+	}
+	flag.StringVar(&name, "name", name, "name of the testnet to manage, prefixes all of its Docker resources")
+	kindsFile := flag.String("kinds", defaultKindsFile(), "YAML or JSON file declaring custom router kinds")
+	flag.Usage = showHelp
+	flag.Parse()
+	if err := setTestnetName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := loadKinds(*kindsFile); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Any arguments run a single subcommand, for scripts and CI
+	if flag.NArg() > 0 {
+		os.Exit(runCLI(cli, ctx, flag.Args()))
+	}
+
 	// Ensure cleanup is performed on exit
 	defer func() {
-		if running {
+		if running() {
 			log.Debug("Performing cleanup on exit")
-			cleanup(cli, ctx, createdContainers, createdVolumes, NETWORK)
+			shutdown(ctx)
 		}
 	}()
 
@@ -394,7 +335,7 @@ func main() {
 	log.Debug("Initializing readline interface")
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:          "\033[31mgo-i2p-testnet»\033[0m ",
-		AutoComplete:    completer,
+		AutoComplete:    newCompleter(),
 		HistoryFile:     "/tmp/readline.tmp", // Optional: Enable command history
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
@@ -405,6 +346,9 @@ func main() {
 	defer rl.Close()
 	log.Debug("Starting command loop")
 	fmt.Println("Logging is available, check README.md for details. Set env DEBUG_TESTNET to debug, warn or error")
+	if state.Exists(statePath) {
+		fmt.Printf("Found state of testnet %s from an earlier session in %s, use 'attach' to manage it\n", testnetName, statePath)
+	}
 	for {
 		line, err := rl.Readline()
 		if err != nil { //EOF
@@ -416,209 +360,22 @@ func main() {
 			continue
 		}
 
-		log.WithField("command", parts[0]).Debug("Processing command")
-
 		// handle commands
 		switch parts[0] {
 		case "help":
 			showHelp()
-		case "start":
-			if running {
-				fmt.Println("Testnet is already running")
-			} else {
-				start(cli, ctx)
-			}
-		case "stop":
-			if running {
-				cleanup(cli, ctx, createdContainers, createdVolumes, NETWORK)
-				running = false
-			} else {
-				fmt.Println("Testnet isn't running")
-			}
-		case "status":
-			status(cli, ctx)
-		case "usage":
-			if !running {
-				fmt.Println("Testnet isn't running")
-			} else {
-				usage(cli, ctx)
-			}
-		case "build":
-			if running {
-				fmt.Println("Testnet is running, not safe to build")
-			} else {
-				err := buildImages(cli, ctx)
-				if err != nil {
-					fmt.Printf("failed to build images: %v\n", err)
-				}
-			}
-		case "rebuild":
-			if running {
-				fmt.Println("Testnet is running, not safe to rebuild")
-			} else {
-				err := rebuildImages(cli, ctx)
-				if err != nil {
-					fmt.Printf("failed to rebuild images: %v\n", err)
-				}
-			}
-		case "remove_images":
-			if running {
-				fmt.Println("Testnet is running, not safe to remove images")
-			} else {
-				err := removeImages(cli, ctx)
-				if err != nil {
-					fmt.Printf("failed to remove images: %v\n", err)
-				}
-			}
-		case "add":
-			if len(parts) < 2 {
-				fmt.Println("Specify the type of router to add. Usage: add [goi2p_router|i2pd_router]")
-				continue
-			}
-			switch parts[1] {
-			case "goi2p_router":
-				if !running {
-					fmt.Println("Testnet isn't running")
-				} else {
-					err := addGOI2PRouter(cli, ctx)
-					if err != nil {
-						fmt.Printf("failed to add router: %v\n", err)
-					}
-				}
-			case "i2pd_router":
-				if !running {
-					fmt.Println("Testnet isn't running")
-				} else {
-					err := addI2PDRouter(cli, ctx)
-					if err != nil {
-						fmt.Printf("failed to add router: %v\n", err)
-					}
-				}
-			default:
-				fmt.Println("Unknown router type. Available types: goi2p_router, i2pd_router")
-			}
-		case "sync_i2pd_shared":
-			if !running {
-				fmt.Println("Testnet isn't running")
-			} else {
-				log.Debug("Syncing netDb from all router containers to the shared volume")
-
-				// Iterate through all created router containers
-				for _, containerID := range createdContainers {
-					log.WithField("containerID", containerID).Debug("Syncing netDb for container")
-
-					// Sync the netDb directory to the shared volume
-					err := i2pd.SyncNetDbToShared(cli, ctx, containerID, sharedVolumeName) // Pass sharedVolumeName
-					if err != nil {
-						fmt.Printf("Failed to sync netDb from container %s: %v\n", containerID, err)
-					} else {
-						fmt.Printf("Successfully synced netDb from container %s to shared volume\n", containerID)
-					}
-				}
-			}
-		case "sync_i2pd_netdb":
-			if !running {
-				fmt.Println("Testnet isn't running")
-			} else {
-				log.Debug("Syncing netDb from shared volume to all router containers")
-
-				// Sync from shared volume to all router containers
-				for _, containerID := range createdContainers {
-					log.WithField("containerID", containerID).Debug("Syncing netDb from shared volume to container")
-
-					// Sync the shared netDb to the container
-					err := i2pd.SyncSharedToNetDb(cli, ctx, containerID, sharedVolumeName)
-					if err != nil {
-						fmt.Printf("Failed to sync netDb to container %s: %v\n", containerID, err)
-						continue
-					} else {
-						fmt.Printf("Successfully synced netDb to container %s from shared volume\n", containerID)
-					}
-				}
-
-				// Sync each container's RouterInfo back to the shared netDb
-				log.Debug("Syncing RouterInfo from each container to the shared netDb")
-				for _, containerID := range createdContainers {
-					log.WithField("containerID", containerID).Debug("Syncing RouterInfo from container to shared netDb")
-
-					// Sync the RouterInfo from the container to the shared netDb
-					err := i2pd.SyncRouterInfoToNetDb(cli, ctx, containerID, sharedVolumeName)
-					if err != nil {
-						fmt.Printf("Failed to sync RouterInfo from container %s to shared netDb: %v\n", containerID, err)
-					} else {
-						fmt.Printf("Successfully synced RouterInfo from container %s to shared netDb\n", containerID)
-					}
-				}
-			}
-
 		case "exit":
 			fmt.Println("Exiting...")
-			if running {
-				cleanup(cli, ctx, createdContainers, createdVolumes, NETWORK)
+			if running() {
+				shutdown(ctx)
 			}
 			return
-		default:
-			fmt.Println("Unknown command. Type 'help' for a list of commands")
-
 		case "hidden": // This is used for debugging and experimental reasons, not meant to be used for the end user
-			if len(parts) < 2 {
-				fmt.Println("Specify hidden command")
-				continue
-			}
-			switch parts[1] {
-			case "extract":
-				if len(parts) < 4 {
-					fmt.Println("Usage: hidden extract <containerID> <filePath>")
-					continue
-				}
-
-				containerID := parts[2]
-				filePath := parts[3]
-
-				content, err := docker_control.ReadFileFromContainer(cli, ctx, containerID, filePath)
-				if err != nil {
-					fmt.Printf("Error extracting file: %v\n", err)
-					continue
-				}
-
-				fmt.Println("File content:")
-				fmt.Println(content)
-			case "read_router_info":
-				if len(parts) < 4 {
-					fmt.Println("Usage: hidden read_router_info <containerID> <filePath>")
-					continue
-				}
-
-				containerID := parts[2]
-				filePath := parts[3]
-
-				content, err := docker_control.ReadFileFromContainer(cli, ctx, containerID, filePath)
-				if err != nil {
-					fmt.Printf("Error extracting file: %v\n", err)
-					continue
-				}
-
-				ri, _, err := router_info.ReadRouterInfo([]byte(content))
-				if err != nil {
-					fmt.Printf("Error reading router info: %v\n", err)
-					continue
-				}
-				fmt.Println("Successfully read router info")
-				fmt.Printf("Options: %v\n", ri.Options())
-				fmt.Printf("Signature: %s\n", ri.Signature())
-				fmt.Printf("GoodVersion: %v\n", ri.GoodVersion())
-				identHash := ri.IdentHash()
-				encodedHash := base64.EncodeToString(identHash[:])
-				fmt.Printf("IdentHash: %v\n", encodedHash)
-				fmt.Printf("Network: %v\n", ri.Network())
-				fmt.Printf("Peersize: %v\n", ri.PeerSize())
-				fmt.Printf("Published: %v\n", ri.Published())
-				fmt.Printf("Reachable: %v\n", ri.Reachable())
-				fmt.Printf("RouterAddressCount: %v\n", ri.RouterAddressCount())
-				fmt.Printf("RouterAddresses: %v\n", ri.RouterAddresses())
-				fmt.Printf("RouterIdentity: %v\n", ri.RouterIdentity())
-				fmt.Printf("RouterVersion: %v\n", ri.RouterVersion())
-				fmt.Printf("UnCongested: %v\n", ri.UnCongested())
+			hidden(cli, ctx, parts[1:])
+		default:
+			err := runCommand(cli, ctx, parts)
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				fmt.Println(err)
 			}
 		}
 	}
@@ -628,57 +385,194 @@ func main() {
 	fmt.Println("\nReceived interrupt signal. Initiating cleanup...")
 }
 
+// hidden runs debugging commands that are not meant for the end user
+func hidden(cli *client.Client, ctx context.Context, parts []string) {
+	if len(parts) < 1 {
+		fmt.Println("Specify hidden command")
+		return
+	}
+	switch parts[0] {
+	case "extract":
+		if len(parts) < 3 {
+			fmt.Println("Usage: hidden extract <containerID> <filePath>")
+			return
+		}
+
+		containerID := parts[1]
+		filePath := parts[2]
+
+		content, err := docker_control.ContainerFS(cli, containerID, "/").ReadFile(ctx, filePath)
+		if err != nil {
+			fmt.Printf("Error extracting file: %v\n", err)
+			return
+		}
+
+		fmt.Println("File content:")
+		fmt.Println(string(content))
+	case "read_router_info":
+		if len(parts) < 3 {
+			fmt.Println("Usage: hidden read_router_info <containerID> <filePath>")
+			return
+		}
+
+		containerID := parts[1]
+		filePath := parts[2]
+
+		content, err := docker_control.ContainerFS(cli, containerID, "/").ReadFile(ctx, filePath)
+		if err != nil {
+			fmt.Printf("Error extracting file: %v\n", err)
+			return
+		}
+
+		ri, _, err := router_info.ReadRouterInfo(content)
+		if err != nil {
+			fmt.Printf("Error reading router info: %v\n", err)
+			return
+		}
+		fmt.Println("Successfully read router info")
+		fmt.Printf("Options: %v\n", ri.Options())
+		fmt.Printf("Signature: %s\n", ri.Signature())
+		fmt.Printf("GoodVersion: %v\n", ri.GoodVersion())
+		identHash := ri.IdentHash()
+		encodedHash := base64.EncodeToString(identHash[:])
+		fmt.Printf("IdentHash: %v\n", encodedHash)
+		fmt.Printf("Network: %v\n", ri.Network())
+		fmt.Printf("Peersize: %v\n", ri.PeerSize())
+		fmt.Printf("Published: %v\n", ri.Published())
+		fmt.Printf("Reachable: %v\n", ri.Reachable())
+		fmt.Printf("RouterAddressCount: %v\n", ri.RouterAddressCount())
+		fmt.Printf("RouterAddresses: %v\n", ri.RouterAddresses())
+		fmt.Printf("RouterIdentity: %v\n", ri.RouterIdentity())
+		fmt.Printf("RouterVersion: %v\n", ri.RouterVersion())
+		fmt.Printf("UnCongested: %v\n", ri.UnCongested())
+	}
+}
+
 func showHelp() {
+	fmt.Println("Usage: go-i2p-testnet [--name <testnet>] [--kinds <file>] [command [arguments]]")
+	fmt.Println("Without a command an interactive shell is started. Commands given on the command line")
+	fmt.Println("run against the testnet recorded in the state file and exit with a non-zero status on failure.")
+	fmt.Println("--name (or TESTNET_NAME) selects the testnet, default " + docker_control.DEFAULT_TESTNET + ".")
+	fmt.Println("--kinds (or TESTNET_KINDS) declares custom router kinds, default " + DEFAULT_KINDS_FILE + " in the state directory.")
+	fmt.Println()
 	fmt.Println("Available commands:")
 	fmt.Println("  help						- Show this help message")
-	fmt.Println("  start						- Start the testnet")
+	fmt.Println("  start [--name <testnet>] [--topology <file>] [--parallel <n>] [--subnet <cidr>] [--ipv6] [--subnet6 <cidr>]")
+	fmt.Println("						- Start the testnet, optionally creating the routers listed in a topology file")
+	fmt.Println("						  --subnet picks the network's IPv4 subnet, e.g. 10.200.0.0/20, instead of the first free /16")
+	fmt.Println("						  --ipv6 makes the network dual-stack, on a random unique local /64 unless --subnet6 picks one")
 	fmt.Println("  stop						- Stop testnet and cleanup routers")
-	fmt.Println("  status					- Show status")
+	fmt.Println("  attach [testnet]				- Take over the testnet recorded in the state file, e.g. after a crash")
+	fmt.Println("  list						- List the testnets that have a state file")
+	fmt.Println("  status [--json]				- Show status and readiness of the routers")
 	fmt.Println("  usage                  			    - Show memory and CPU usage of router containers")
-	fmt.Println("  build						- Build docker images for nodes")
+	fmt.Println("  build [kind...] [--src <path>] [--version <v>]	- Build docker images for nodes, all kinds unless given")
+	fmt.Println("						  --src builds go-i2p from a local git checkout: build goi2p --src ../go-i2p")
+	fmt.Println("						  --version pins a go-i2p git ref or an i2pd/Java release: build i2pd --version 2.54.0")
 	fmt.Println("  rebuild					- Rebuild docker images for nodes")
 	fmt.Println("  remove_images					- Removes all node images")
-	fmt.Println("  add <nodetype> 				- Available node types are go-i2p and i2pd")
+	fmt.Println("  images list					- List the images of all router kinds and the helper images, with their versions")
+	fmt.Println("  images export <bundle.tar> [kind...]		- Save those images and a manifest of their versions to a bundle")
+	fmt.Println("  images import <bundle.tar>			- Load the images of a bundle, e.g. on a machine without registry access")
+	fmt.Println("  add [--kind <kind>] [--count <n>] [--floodfill] [--parallel <n>] [--version <v>] [--address-family <f>]")
+	fmt.Println("      [--behind-nat [full-cone|symmetric]] [--publish] [--transports <list>] [--published-transports <list>] [kind] [count]")
+	fmt.Println("						- Add routers, available kinds are " + kindList("_router"))
+	fmt.Println("						  --parallel sets how many routers are created at once (default 4)")
+	fmt.Println("						  --version runs an image version other than latest, building it if needed")
+	fmt.Println("						  --address-family limits routers on a dual-stack testnet to ipv4 or ipv6 (default dual)")
+	fmt.Println("						  --behind-nat puts each router on a private network behind a NAT gateway (default full-cone)")
+	fmt.Println("						  --publish makes the routers' console, proxies, SAM, I2CP and I2PControl reachable from the host")
+	fmt.Println("						  --transports enables only some of ntcp2,ssu2 and --published-transports publishes only some, or none")
+	fmt.Println("						  (i2pd and java only: go-i2p has no transport settings and always enables and publishes both)")
+	fmt.Println("  remove [--timeout <s>] <node>...		- Stop routers gracefully and delete their containers and volumes")
+	fmt.Println("  restart [--timeout <s>] <node>...		- Restart routers, shutting them down gracefully first")
+	fmt.Println("  stop-node [--timeout <s>] <node>...		- Stop routers gracefully (i2pd drains its transit tunnels), keeping their data")
+	fmt.Println("  start-node <node>...				- Start stopped routers again")
+	fmt.Println("  pause <node>... / unpause <node>...		- Freeze and resume routers")
+	fmt.Println("  wait-ready [--timeout <d>] [--tunnels] [<node>...|all]")
+	fmt.Println("						- Wait until routers have their router.info, console and transports up (--tunnels: and built a tunnel)")
+	fmt.Println("  logs [--tail <n>] [--level <level>] <node>	- Show a router's log, --level keeps lines of at least debug, info, warn or error")
+	fmt.Println("  netem <node> [delay <d>] [jitter <d>] [loss <percent>] [rate <rate>]")
+	fmt.Println("						- Emulate a slow or lossy link on a router, e.g. netem 3 delay 120ms jitter 20ms loss 2% rate 1mbit")
+	fmt.Println("  netem <node> [clear]				- Show, or clear, a router's link conditions")
+	fmt.Println("  partition [<group>=<node>,<node>... ...]	- Cut groups of routers off from each other, e.g. partition A=1,2 B=3,4")
+	fmt.Println("						  routers in no group form the group rest; without groups the partition is shown")
+	fmt.Println("  heal						- Let all routers reach each other again after partition")
+	fmt.Println("  ports [--json] [<node>...]			- List the host ports the services of routers added with --publish are reachable on")
+	fmt.Println("  save_topology <file>				- Write the running testnet's routers to a YAML or JSON topology file")
+	fmt.Println("  sync						- Synchronize netDb through the shared volume (sync_shared + sync_netdb)")
+	fmt.Println("  sync_shared					- Copy each router's RouterInfo to the shared volume (also: sync_i2pd_shared)")
+	fmt.Println("  sync_netdb					- Copy the shared netDb into every router (also: sync_i2pd_netdb)")
+	fmt.Println("  prune [--dry-run] [--all]			- Remove containers, volumes and networks left behind by earlier runs of this testnet (--all: of any testnet)")
 	fmt.Println("  exit						- Exit the CLI")
+	fmt.Println()
+	fmt.Println("<node> is a router ID, container name (router-i2pd-1) or container ID prefix.")
 }
 
-func buildImages(cli *client.Client, ctx context.Context) error {
-	log.Debug("Building go-i2p node image")
-	err := goi2pnode.BuildImage(cli, ctx)
-	if err != nil {
-		log.WithError(err).Error("Failed to build go-i2p node image")
-		return err
+// kindNames returns the names of the registered router kinds, each with suffix appended
+func kindNames(suffix string) []string {
+	names := nodekind.Names()
+	for i := range names {
+		names[i] += suffix
 	}
-	log.Debug("Successfully built go-i2p node image")
+	return names
+}
 
-	log.Debug("Building i2pd node image")
-	err = i2pd.BuildImage(cli, ctx)
-	if err != nil {
-		log.WithError(err).Error("Failed to build i2pd node image")
-		return err
+// kindList lists the registered router kinds for help texts, each with suffix appended
+func kindList(suffix string) string {
+	names := kindNames(suffix)
+	if len(names) < 2 {
+		return strings.Join(names, "")
 	}
-	log.Debug("Successfully built i2pd node image")
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
 
+func buildImages(cli *client.Client, ctx context.Context) error {
+	for _, k := range nodekind.All() {
+		if err := buildImage(cli, ctx, k.Name(), docker_control.VERSION_LATEST); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func removeImages(cli *client.Client, ctx context.Context) error {
-	log.Debug("Removing go-i2p node image")
-	err := goi2pnode.RemoveImage(cli, ctx)
-	if err != nil {
-		log.WithError(err).Error("Failed to remove go-i2p node image")
-		return err
+// buildImage builds the node image of one router kind at a version
+func buildImage(cli *client.Client, ctx context.Context, kind string, version string) error {
+	k, ok := nodekind.Lookup(kind)
+	if !ok {
+		return usageError{fmt.Sprintf("unknown router kind %q. Available kinds: %s", kind, strings.Join(nodekind.Names(), ", "))}
 	}
-	log.Debug("Successfully removed go-i2p node image")
-
-	log.Debug("Removing i2pd node image")
-	err = i2pd.RemoveImage(cli, ctx)
-	if err != nil {
-		log.WithError(err).Error("Failed to remove i2pd node image")
+	log.WithFields(map[string]interface{}{
+		"kind":    k.Name(),
+		"version": version,
+	}).Debug("Building node image")
+	if err := k.BuildImage(cli, ctx, version); err != nil {
+		log.WithFields(map[string]interface{}{
+			"kind":    k.Name(),
+			"version": version,
+			"error":   err,
+		}).Error("Failed to build node image")
 		return err
 	}
-	log.Debug("Successfully removed i2pd node image")
+	log.WithFields(map[string]interface{}{
+		"kind":    k.Name(),
+		"version": version,
+	}).Debug("Successfully built node image")
+	return nil
+}
 
+func removeImages(cli *client.Client, ctx context.Context) error {
+	for _, k := range nodekind.All() {
+		log.WithField("kind", k.Name()).Debug("Removing node image")
+		if err := k.RemoveImage(cli, ctx); err != nil {
+			log.WithFields(map[string]interface{}{
+				"kind":  k.Name(),
+				"error": err,
+			}).Error("Failed to remove node image")
+			return err
+		}
+		log.WithField("kind", k.Name()).Debug("Successfully removed node image")
+	}
 	return nil
 }
 
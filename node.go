@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-i2p-testnet/lib/state"
+)
+
+// nodeAction runs a lifecycle command on a single router
+func nodeAction(ctx context.Context, action string, r state.Router, timeout int) error {
+	switch action {
+	case "remove":
+		return tn.RemoveRouter(ctx, r, timeout)
+	case "restart":
+		return tn.RestartRouter(ctx, r, timeout)
+	case "stop-node":
+		return tn.StopRouter(ctx, r, timeout)
+	case "start-node":
+		return tn.StartRouter(ctx, r)
+	case "pause":
+		return tn.PauseRouter(ctx, r)
+	case "unpause":
+		return tn.UnpauseRouter(ctx, r)
+	default:
+		return fmt.Errorf("unknown router action %q", action)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/client"
+	"go-i2p-testnet/lib/docker_control"
+	"go-i2p-testnet/lib/state"
+	"go-i2p-testnet/lib/testnet"
+	"sync"
+)
+
+// TESTNET_NAME_ENV selects the testnet to manage when --name is not given
+const TESTNET_NAME_ENV = "TESTNET_NAME"
+
+// statePath is where the testnet state is kept between invocations
+var statePath string
+
+// saveMu serialises writes of the state file, which routers created in parallel would otherwise race on
+var saveMu sync.Mutex
+
+// setTestnetName selects the testnet this process manages and its state file
+func setTestnetName(name string) error {
+	if err := docker_control.ValidateTestnetName(name); err != nil {
+		return err
+	}
+	path, err := state.PathFor(name)
+	if err != nil {
+		return err
+	}
+	testnetName = name
+	statePath = path
+	return nil
+}
+
+// loadState restores the testnet from the state file, if one exists
+func loadState(cli *client.Client) error {
+	s, err := state.Load(statePath)
+	if errors.Is(err, state.ErrNoState) {
+		log.WithField("path", statePath).Debug("No saved testnet state")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tn = testnet.FromState(cli, s)
+	return nil
+}
+
+// saveState writes the testnet to the state file, or removes the file once the testnet is stopped
+func saveState() error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	if !running() {
+		return state.Remove(statePath)
+	}
+	return state.Save(statePath, tn.State())
+}
+
+// persistState saves the testnet state in the middle of an operation, so a crash leaves a usable record behind
+func persistState() {
+	if err := saveState(); err != nil {
+		log.WithError(err).Error("Failed to save testnet state")
+		fmt.Printf("Warning: failed to save testnet state: %v\n", err)
+	}
+}
+
+// attach rebuilds the in-memory testnet from the state file, checking every recorded resource against Docker
+func attach(cli *client.Client, ctx context.Context) error {
+	s, err := state.Load(statePath)
+	if errors.Is(err, state.ErrNoState) {
+		return fmt.Errorf("no testnet state found in %s", statePath)
+	}
+	if err != nil {
+		return err
+	}
+	t, dropped, err := testnet.Attach(cli, ctx, s)
+	if err != nil {
+		return err
+	}
+	for _, r := range dropped {
+		fmt.Printf("Router %d (%s) no longer exists, dropping it\n", r.ID, r.Kind)
+	}
+	tn = t
+	fmt.Printf("Attached to testnet %s with %d routers\n", t.NetworkName(), len(t.Routers()))
+	return nil
+}